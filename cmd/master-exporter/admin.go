@@ -0,0 +1,186 @@
+/*
+ * admin.go --- Admin API.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"github.com/Asmodai/master-exporter/internal/config"
+	"github.com/Asmodai/master-exporter/internal/exporter"
+
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	adminPrefix string = "/-/admin/exporters/"
+)
+
+type adminResponse struct {
+	Name   string           `json:"name"`
+	Action string           `json:"action"`
+	Result *exporter.Result `json:"result,omitempty"`
+	Status *exporter.Status `json:"status,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+func (m *MasterExporter) adminToken() string {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.config.AppConfig.(*config.AppConfig).Admin.Token.Value()
+}
+
+// Require the admin token.
+//
+// The token is given as a bearer token, or in the `X-Admin-Token` header
+// when the `Authorization` header is taken by basic authentication.
+// Without a token configured, the endpoint is disabled altogether.
+func (m *MasterExporter) protect(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := m.adminToken()
+		if token == "" {
+			http.Error(w, "Admin API is disabled.", http.StatusNotFound)
+
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if header := r.Header.Get("X-Admin-Token"); header != "" {
+			given, ok = header, true
+		}
+
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="master-exporter"`)
+			http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func writeAdmin(w http.ResponseWriter, status int, resp *adminResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Act on a single exporter instance.
+//
+// Requests are of the form `POST /-/admin/exporters/<name>/<action>`,
+// where the name is the process name (`type` or `type:instance`) and the
+// action is one of `scrape`, `pause`, `resume` or `interval`.  The last
+// takes the new interval in seconds as the `interval` parameter.
+func (m *MasterExporter) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST is allowed.", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, adminPrefix)
+	idx := strings.LastIndex(path, "/")
+	if idx <= 0 {
+		http.Error(w, "Expected <name>/<action>.", http.StatusNotFound)
+
+		return
+	}
+
+	resp := &adminResponse{
+		Name:   path[:idx],
+		Action: path[idx+1:],
+	}
+
+	var err error
+
+	switch resp.Action {
+	case "scrape":
+		resp.Result, err = m.pool.Trigger(resp.Name)
+
+	case "pause":
+		resp.Status, err = m.pool.Pause(resp.Name)
+
+	case "resume":
+		resp.Status, err = m.pool.Resume(resp.Name)
+
+	case "interval":
+		var interval int
+
+		interval, err = strconv.Atoi(r.FormValue("interval"))
+		if err != nil {
+			resp.Error = "Interval must be a number of seconds."
+			writeAdmin(w, http.StatusBadRequest, resp)
+
+			return
+		}
+
+		resp.Status, err = m.pool.SetInterval(resp.Name, interval)
+
+	default:
+		resp.Error = "Unknown action."
+		writeAdmin(w, http.StatusNotFound, resp)
+
+		return
+	}
+
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, exporter.ErrNotFound):
+		status = http.StatusNotFound
+
+	case errors.Is(err, exporter.ErrBadState):
+		status = http.StatusConflict
+
+	case err != nil:
+		status = http.StatusBadRequest
+	}
+
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	// Every action reports the latest scrape result.
+	if resp.Status == nil && err == nil {
+		resp.Status, _ = m.pool.StatusOf(resp.Name)
+	}
+
+	if resp.Result == nil && resp.Status != nil {
+		resp.Result = resp.Status.Last
+	}
+
+	writeAdmin(w, status, resp)
+}
+
+/* admin.go ends here. */
@@ -1,7 +1,7 @@
 /*
- * sabnzbd.go --- SabNZBd exporter.
+ * check.go --- Configuration check command.
  *
- * Copyright (c) 2022-2024 Paul Ward <asmodai@gmail.com>
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
  *
  * Author:     Paul Ward <asmodai@gmail.com>
  * Maintainer: Paul Ward <asmodai@gmail.com>
@@ -30,46 +30,37 @@
 package main
 
 import (
-	"github.com/Asmodai/gohacks/utils"
-
 	"github.com/Asmodai/master-exporter/internal/config"
-	"github.com/Asmodai/master-exporter/internal/exporter"
-	"github.com/Asmodai/master-exporter/internal/sabnzbd"
+
+	"fmt"
+	"os"
+	"strings"
 )
 
-func (m *MasterExporter) initSab() {
-	cnf := m.config.AppConfig.(*config.AppConfig)
+// Check a configuration file without starting anything.
+//
+// Every problem found is printed on its own line.  Returns the exit
+// status.
+func checkConfig(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: master-exporter check-config <file>")
 
-	if !utils.Member(cnf.Enabled, "sabnzbd") {
-		return
+		return 2
 	}
 
-	exp := sabnzbd.NewExporter(
-		m.apic,
-		m.config.Logger,
-		cnf.SabNZBd,
-	)
+	if _, err := config.Load(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: configuration is invalid:\n", args[0])
 
-	// Scrape now
-	if err := exp.Scrape(); err != nil {
-		panic(err.Error())
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "  %s\n", line)
+		}
+
+		return 1
 	}
-	m.config.Logger.Info(
-		"Initial scrape complete.",
-		"exporter", "sabnzbd",
-	)
 
-	params := exporter.NewParams(
-		"sabnzbd",
-		exp,
-		m.config.ProcessManager,
-		m.config.Logger,
-	)
+	fmt.Printf("%s: configuration is valid.\n", args[0])
 
-	_, err := exporter.Spawn(params)
-	if err != nil {
-		panic(err.Error())
-	}
+	return 0
 }
 
-/* sabnzbd.go ends here. */
+/* check.go ends here. */
@@ -0,0 +1,104 @@
+/*
+ * exporters.go --- Exporter setup.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"github.com/Asmodai/gohacks/app"
+
+	"github.com/Asmodai/master-exporter/internal/config"
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/state"
+)
+
+func (m *MasterExporter) initExporters() {
+	cnf := m.config.AppConfig.(*config.AppConfig)
+
+	store, err := openState(cnf)
+	if err != nil {
+		m.config.Logger.Fatal(
+			"Could not open state directory.",
+			"state_dir", cnf.StateDir,
+			"err", err.Error(),
+		)
+	}
+
+	deps := &exporter.Deps{
+		Context:    m.appl.Context(),
+		Logger:     m.config.Logger,
+		Client:     m.apic,
+		Registerer: m.health,
+		State:      store,
+	}
+
+	pool, err := exporter.NewPool(
+		deps,
+		m.config.ProcessManager,
+		m.config.Logger,
+	)
+	if err != nil {
+		panic(err.Error())
+	}
+	m.pool = pool
+	m.pool.SetTextfile(cnf.Textfile.Directory, m.health)
+
+	// The pool's processes are its own, so the process manager will not
+	// stop them.
+	m.appl.SetOnExit(func(*app.Application) {
+		m.pool.StopAll()
+	})
+
+	// Exporters that could not be created are logged rather than fatal,
+	// so the others keep working.
+	changes, err := m.pool.Apply(cnf.Enabled, cnf.Exporters)
+	if err != nil {
+		m.config.Logger.Error(
+			"Errors while starting exporters.",
+			"err", err.Error(),
+		)
+	}
+
+	if len(changes.Retrying) > 0 {
+		m.config.Logger.Warn(
+			"Some exporters are not ready yet.",
+			"retrying", changes.Retrying,
+		)
+	}
+}
+
+// Open the state store, if one is configured.
+func openState(cnf *config.AppConfig) (*state.Store, error) {
+	if cnf.StateDir == "" {
+		return nil, nil
+	}
+
+	return state.NewStore(cnf.StateDir)
+}
+
+/* exporters.go ends here. */
@@ -0,0 +1,80 @@
+/*
+ * health.go --- Health endpoints.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Report that the exporter is up and able to serve requests.
+func (m *MasterExporter) healthyHandler(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintln(w, "Healthy.")
+}
+
+// Report whether every exporter has completed its initial scrape.
+//
+// Exporters that are still retrying are listed, one per line, along with
+// the error from their last attempt.
+func (m *MasterExporter) readyHandler(w http.ResponseWriter, _ *http.Request) {
+	pending := m.pool.Pending()
+	if len(pending) == 0 {
+		fmt.Fprintln(w, "Ready.")
+
+		return
+	}
+
+	names := []string{}
+	for k := range pending {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+
+	for _, name := range names {
+		if err := pending[name]; err != nil {
+			fmt.Fprintf(w, "%s: retrying: %s\n", name, err.Error())
+		} else {
+			fmt.Fprintf(w, "%s: retrying\n", name)
+		}
+	}
+}
+
+// Report the status of every exporter as JSON.
+func (m *MasterExporter) exportersHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m.pool.Status())
+}
+
+/* health.go ends here. */
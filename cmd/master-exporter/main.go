@@ -37,6 +37,15 @@ import (
 	"github.com/Asmodai/gohacks/semver"
 
 	"github.com/Asmodai/master-exporter/internal/config"
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/metrics"
+	"github.com/Asmodai/master-exporter/internal/probe"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"os"
+	"strings"
+	"sync"
 )
 
 var (
@@ -44,12 +53,69 @@ var (
 )
 
 type MasterExporter struct {
-	config *app.Config
-	appl   *app.Application
-	apic   apiclient.IApiClient
+	sync.Mutex
+
+	// Held for the whole of a reload, which can take a while.
+	reloadMu sync.Mutex
+
+	config   *app.Config
+	confFile string
+	appl     *app.Application
+	apic     apiclient.IApiClient
+
+	// Our own metrics and the health of the exporters are kept apart
+	// from the Go runtime's, so that they can be written out as a
+	// textfile without clashing with node_exporter's.
+	registry *prometheus.Registry
+	health   *prometheus.Registry
+	self     *metrics.Self
+	pool     *exporter.Pool
+	probe    *probe.Handler
+}
+
+// Take the configuration file out of the command line.
+//
+// The application framework only reads JSON, so we load the file
+// ourselves and leave the framework with nothing to load.
+func takeConfigFlag() string {
+	args := []string{os.Args[0]}
+	path := ""
+
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+
+		name, value, ok := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			args = append(args, arg)
+			continue
+		}
+
+		if !ok && i+1 < len(os.Args) {
+			i++
+			value = os.Args[i]
+		}
+
+		path = value
+	}
+	os.Args = args
+
+	return path
+}
+
+// Load the configuration file, or the defaults if there is none.
+func loadConfig(path string) (*config.AppConfig, error) {
+	if path == "" {
+		cnf := &config.AppConfig{}
+
+		return cnf, cnf.Init()
+	}
+
+	return config.Load(path)
 }
 
 func NewMasterExporter() *MasterExporter {
+	path := takeConfigFlag()
+
 	version, err := semver.MakeSemVer(GitVers)
 	if err != nil {
 		panic(err.Error())
@@ -67,9 +133,15 @@ func NewMasterExporter() *MasterExporter {
 	c.ProcessManager.SetContext(a.Context())
 	a.Init()
 
-	if err := c.AppConfig.(*config.AppConfig).Init(); err != nil {
-		panic(err.Error())
+	loaded, err := loadConfig(path)
+	if err != nil {
+		c.Logger.Fatal(
+			"Invalid configuration.",
+			"file", path,
+			"err", err.Error(),
+		)
 	}
+	*c.AppConfig.(*config.AppConfig) = *loaded
 
 	apic := apiclient.NewClient(
 		c.AppConfig.(*config.AppConfig).GetAPIClient(),
@@ -77,24 +149,35 @@ func NewMasterExporter() *MasterExporter {
 	)
 
 	return &MasterExporter{
-		config: c,
-		appl:   a,
-		apic:   apic,
+		config:   c,
+		confFile: path,
+		appl:     a,
+		apic:     apic,
+		registry: metrics.NewRegistry(),
+		health:   prometheus.NewRegistry(),
 	}
 }
 
 func (m *MasterExporter) Main() {
-	m.initOMW()
-	m.initSab()
-	m.initNG()
-	m.initIcmp()
-	m.initDns()
+	m.initSelf()
+	m.initExporters()
 	m.initPrometheus()
+	m.initReload()
 
 	m.appl.Run()
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check-config":
+			os.Exit(checkConfig(os.Args[2:]))
+
+		case "scrape":
+			os.Exit(scrapeOnce(os.Args[2:]))
+		}
+	}
+
 	me := NewMasterExporter()
 
 	me.Main()
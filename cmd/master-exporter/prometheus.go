@@ -30,20 +30,76 @@
 package main
 
 import (
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/Asmodai/master-exporter/internal/config"
+	"github.com/Asmodai/master-exporter/internal/probe"
+	"github.com/Asmodai/master-exporter/internal/web"
 
-	"fmt"
 	"net/http"
 )
 
 func (m *MasterExporter) initPrometheus() {
 	cnf := m.config.AppConfig.(*config.AppConfig)
 
-	http.Handle("/metrics", promhttp.Handler())
+	// Reloading needs the prober even if nothing can reach it.
+	m.probe = probe.NewHandler(cnf.Probe, m.config.Logger)
+
+	if !cnf.Textfile.ServeHTTP() {
+		m.config.Logger.Info(
+			"Not serving HTTP; writing textfiles only.",
+			"directory", cnf.Textfile.Directory,
+		)
+
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(
+		prometheus.Gatherers{m.registry, m.health, m.pool},
+		promhttp.HandlerOpts{
+			Registry: m.registry,
+		},
+	))
+	mux.HandleFunc("/-/reload", m.protect(m.reloadHandler))
+	mux.HandleFunc(adminPrefix, m.protect(m.adminHandler))
+	mux.HandleFunc("/-/healthy", m.healthyHandler)
+	mux.HandleFunc("/-/ready", m.readyHandler)
+	mux.HandleFunc("/-/exporters", m.exportersHandler)
+
+	mux.Handle("/probe", m.probe)
+
+	srv, err := web.NewServer(cnf.Web, mux, m.config.Logger)
+	if err != nil {
+		m.config.Logger.Fatal(
+			"Could not configure HTTP server.",
+			"err", err.Error(),
+		)
+	}
+
+	listeners, err := web.Listeners(cnf.Listen)
+	if err != nil {
+		m.config.Logger.Fatal(
+			"Could not listen.",
+			"err", err.Error(),
+		)
+	}
+
+	for _, listener := range listeners {
+		m.config.Logger.Info(
+			"Listening.",
+			"addr", listener.Addr().String(),
+		)
+	}
+
 	go func() {
-		_ = http.ListenAndServe(fmt.Sprintf(":%d", cnf.BasePort), nil)
+		if err := srv.Serve(m.appl.Context(), listeners...); err != nil {
+			m.config.Logger.Fatal(
+				"Could not serve HTTP.",
+				"err", err.Error(),
+			)
+		}
 	}()
 }
 
@@ -0,0 +1,160 @@
+/*
+ * reload.go --- Configuration reload.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"github.com/Asmodai/gohacks/app"
+
+	"github.com/Asmodai/master-exporter/internal/config"
+	"github.com/Asmodai/master-exporter/internal/exporter"
+
+	"encoding/json"
+	"net/http"
+	"reflect"
+)
+
+type reloadResponse struct {
+	*exporter.Changes
+
+	Error string `json:"error,omitempty"`
+}
+
+func (m *MasterExporter) initReload() {
+	m.appl.SetOnHUP(func(*app.Application) {
+		_, _ = m.reload()
+	})
+}
+
+// Re-read the configuration file, along with any fragments, and apply
+// it to the running exporters.  Started without a configuration file,
+// the defaults are applied again.
+//
+// Only the exporter sections, the list of enabled exporters, the probe
+// modules and the admin token are reloaded; anything else requires a
+// restart.
+//
+// Reloads are serialised, but the exporter's own lock is only held while
+// swapping in the new configuration, so that the other endpoints keep
+// answering while new exporters make their initial scrapes.
+func (m *MasterExporter) reload() (*exporter.Changes, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	// The outcome is written out whatever it is.
+	defer m.pool.WriteTextfile()
+
+	path := m.confFile
+	cnf, err := loadConfig(path)
+	if err != nil {
+		m.self.SetFailed()
+		m.config.Logger.Error(
+			"Could not reload configuration.",
+			"file", path,
+			"err", err.Error(),
+		)
+
+		return nil, err
+	}
+
+	old := m.config.AppConfig.(*config.AppConfig)
+	if !reflect.DeepEqual(cnf.Listen, old.Listen) {
+		m.config.Logger.Warn("Listen address change requires a restart.")
+	}
+
+	if !reflect.DeepEqual(cnf.Textfile, old.Textfile) {
+		m.config.Logger.Warn("Textfile change requires a restart.")
+	}
+
+	if cnf.StateDir != old.StateDir {
+		m.config.Logger.Warn("State directory change requires a restart.")
+	}
+
+	changes, err := m.pool.Apply(cnf.Enabled, cnf.Exporters)
+
+	m.Lock()
+	old.Enabled = cnf.Enabled
+	old.Exporters = cnf.Exporters
+	old.Probe = cnf.Probe
+	old.Admin = cnf.Admin
+	m.Unlock()
+
+	m.probe.SetConfig(cnf.Probe)
+
+	// What was applied stays applied, but the configuration as a whole
+	// is not what is running.
+	if err != nil {
+		m.self.SetFailed()
+		m.config.Logger.Error(
+			"Errors while reloading configuration.",
+			"file", path,
+			"err", err.Error(),
+		)
+
+		return changes, err
+	}
+
+	m.self.SetConfig(cnf.Hash(), cnf.EnabledInstances())
+
+	m.config.Logger.Info(
+		"Configuration reloaded.",
+		"file", path,
+		"started", changes.Started,
+		"retrying", changes.Retrying,
+		"stopped", changes.Stopped,
+		"reloaded", changes.Reloaded,
+	)
+
+	return changes, nil
+}
+
+func (m *MasterExporter) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST is allowed.", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	resp := &reloadResponse{}
+	status := http.StatusOK
+
+	changes, err := m.reload()
+	resp.Changes = changes
+	if err != nil {
+		resp.Error = err.Error()
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+/* reload.go ends here. */
@@ -0,0 +1,157 @@
+/*
+ * scrape.go --- One-shot scrape command.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"github.com/Asmodai/gohacks/apiclient"
+	"github.com/Asmodai/gohacks/logger"
+
+	"github.com/Asmodai/master-exporter/internal/config"
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Scrape the chosen exporters once and print their metrics.
+//
+// Every instance of each exporter is scraped, and the metrics of those
+// that succeed are printed even if others fail.  Returns the exit
+// status.
+func scrapeOnce(args []string) int {
+	flags := flag.NewFlagSet("scrape", flag.ContinueOnError)
+	path := flags.String("config", "", "Configuration file")
+	only := flags.String("exporter", "", "Comma-separated exporters to scrape; default is all enabled")
+	format := flags.String("format", metrics.FormatText, "Output format: text, openmetrics or json")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// The file may also be given on its own, as with `check-config`.
+	if *path == "" && flags.NArg() == 1 {
+		*path = flags.Arg(0)
+	}
+
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "Usage: master-exporter scrape [-exporter a,b] [-format text|openmetrics|json] <file>")
+
+		return 2
+	}
+
+	cnf, err := config.Load(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", *path, err.Error())
+
+		return 2
+	}
+
+	types := cnf.Enabled
+	if *only != "" {
+		types = strings.Split(*only, ",")
+	}
+
+	// Calls made here count against the same quotas as the daemon's.
+	store, err := openState(cnf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", cnf.StateDir, err.Error())
+
+		return 2
+	}
+
+	lgr := logger.NewDefaultLogger()
+	reg := prometheus.NewRegistry()
+	deps := &exporter.Deps{
+		Context:    context.Background(),
+		Logger:     lgr,
+		Client:     apiclient.NewClient(cnf.GetAPIClient(), lgr),
+		Registerer: reg,
+		State:      store,
+	}
+
+	status := 0
+	for _, typ := range types {
+		insts, err := exporter.Instances(typ, cnf.Exporters[typ])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			status = 1
+
+			continue
+		}
+
+		for _, inst := range insts {
+			if err := scrapeInstance(deps, inst); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", inst.ProcessName(), err.Error())
+				status = 1
+			}
+		}
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		status = 1
+	}
+
+	if err := metrics.Encode(os.Stdout, mfs, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+
+		return 2
+	}
+
+	return status
+}
+
+func scrapeInstance(deps *exporter.Deps, inst *exporter.Instance) error {
+	obj, err := exporter.Create(deps, inst)
+	if err != nil {
+		return err
+	}
+
+	err = exporter.ScrapeNow(deps.Context, obj)
+
+	// A failed scrape leaves whatever it managed to set, which is no use
+	// to anyone.
+	if err != nil {
+		if closer, ok := obj.(exporter.ICloser); ok {
+			closer.Close()
+		}
+	}
+
+	return err
+}
+
+/* scrape.go ends here. */
@@ -1,7 +1,7 @@
 /*
- * netgear.go --- Netgear exporter.
+ * self.go --- Self-instrumentation.
  *
- * Copyright (c) 2022-2024 Paul Ward <asmodai@gmail.com>
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
  *
  * Author:     Paul Ward <asmodai@gmail.com>
  * Maintainer: Paul Ward <asmodai@gmail.com>
@@ -30,45 +30,21 @@
 package main
 
 import (
-	"github.com/Asmodai/gohacks/utils"
-
 	"github.com/Asmodai/master-exporter/internal/config"
-	"github.com/Asmodai/master-exporter/internal/exporter"
-	"github.com/Asmodai/master-exporter/internal/netgear"
+	"github.com/Asmodai/master-exporter/internal/metrics"
 )
 
-func (m *MasterExporter) initNG() {
+func (m *MasterExporter) initSelf() {
 	cnf := m.config.AppConfig.(*config.AppConfig)
 
-	if !utils.Member(cnf.Enabled, "netgear") {
-		return
-	}
-
-	exp := netgear.NewExporter(
-		m.appl.Context(),
-		m.config.Logger,
-		cnf.Netgear,
-	)
-
-	if err := exp.Scrape(); err != nil {
-		panic(err.Error())
-	}
-	m.config.Logger.Info(
-		"Initial scrape complete.",
-		"exporter", "netgear",
-	)
-
-	params := exporter.NewParams(
-		"netgear",
-		exp,
-		m.config.ProcessManager,
-		m.config.Logger,
-	)
-
-	_, err := exporter.Spawn(params)
+	self, err := metrics.NewSelf(m.health)
 	if err != nil {
 		panic(err.Error())
 	}
+
+	self.SetBuild(m.config.Version.String(), m.config.Version.Commit)
+	self.SetConfig(cnf.Hash(), cnf.EnabledInstances())
+	m.self = self
 }
 
-/* netgear.go ends here. */
+/* self.go ends here. */
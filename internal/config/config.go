@@ -30,26 +30,120 @@
 package config
 
 import (
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/probe"
+	"github.com/Asmodai/master-exporter/internal/secret"
+	"github.com/Asmodai/master-exporter/internal/validate"
+	"github.com/Asmodai/master-exporter/internal/web"
+
 	"github.com/Asmodai/gohacks/apiclient"
 
-	"github.com/Asmodai/master-exporter/internal/dns"
-	"github.com/Asmodai/master-exporter/internal/icmp"
-	"github.com/Asmodai/master-exporter/internal/netgear"
-	"github.com/Asmodai/master-exporter/internal/openweathermap"
-	"github.com/Asmodai/master-exporter/internal/sabnzbd"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
 )
 
+// Settings for the admin API.
+//
+// The API is disabled unless a token is set.
+type AdminConfig struct {
+	Token     secret.String `json:"token"`
+	TokenFile string        `json:"token_file"`
+}
+
+// Settings for writing metrics for the node_exporter textfile collector.
+type TextfileConfig struct {
+	Directory string `json:"directory"`
+
+	// Serve metrics over HTTP as well.  Defaults to true.
+	HTTP *bool `json:"http"`
+}
+
+// Should metrics be served over HTTP?
+func (t *TextfileConfig) ServeHTTP() bool {
+	return t.HTTP == nil || *t.HTTP
+}
+
 type AppConfig struct {
-	BasePort int      `json:"base_port"`
-	Enabled  []string `json:"enabled"`
+	// Directory of configuration fragments to merge in.
+	Include string `json:"include"`
+
+	BasePort int           `json:"base_port"`
+	Listen   []*web.Listen `json:"listen"`
+	Enabled  []string      `json:"enabled"`
+
+	// Directory for state kept across restarts.  Nothing is kept if
+	// this is not set.
+	StateDir string `json:"state_dir"`
 
 	ApiClient *apiclient.Config `json:"api_client"`
+	Probe     *probe.Config     `json:"probe"`
+	Admin     *AdminConfig      `json:"admin"`
+	Web       *web.Config       `json:"web"`
+	Textfile  *TextfileConfig   `json:"textfile"`
+
+	// Exporter configuration sections, keyed by exporter name.
+	//
+	// These are decoded by the exporter's own factory.
+	Exporters map[string]json.RawMessage `json:"-"`
 
-	OpenWeatherMap *openweathermap.Config `json:"openweathermap"`
-	SabNZBd        *sabnzbd.Config        `json:"sabnzbd"`
-	Netgear        *netgear.Config        `json:"netgear"`
-	Icmp           *icmp.Config           `json:"icmp"`
-	Dns            *dns.Config            `json:"dns"`
+	// Our own sections as given, kept for validation.
+	own map[string]json.RawMessage
+
+	hash uint64
+}
+
+// Return the JSON keys used by `AppConfig` itself.
+func ownKeys() map[string]bool {
+	keys := map[string]bool{}
+	typ := reflect.TypeOf(AppConfig{})
+
+	for i := 0; i < typ.NumField(); i++ {
+		tag := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if tag != "" && tag != "-" {
+			keys[tag] = true
+		}
+	}
+
+	return keys
+}
+
+// Decode the configuration, expanding environment variables in every
+// string value first.
+func (c *AppConfig) UnmarshalJSON(data []byte) error {
+	type plain AppConfig
+
+	data, err := secret.Expand(data)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	own := ownKeys()
+	c.own = map[string]json.RawMessage{}
+	c.Exporters = map[string]json.RawMessage{}
+	for k, v := range raw {
+		if own[k] {
+			c.own[k] = v
+		} else {
+			c.Exporters[k] = v
+		}
+	}
+
+	return nil
 }
 
 func (c *AppConfig) Init() error {
@@ -57,21 +151,191 @@ func (c *AppConfig) Init() error {
 		c.BasePort = 9500
 	}
 
+	// Without a listen list we listen on the base port on all
+	// interfaces.
+	if len(c.Listen) == 0 {
+		c.Listen = []*web.Listen{
+			{Address: fmt.Sprintf(":%d", c.BasePort)},
+		}
+	}
+
 	if c.ApiClient == nil {
 		c.ApiClient = apiclient.NewDefaultConfig()
 	}
 
-	openweathermap.Validate(c.OpenWeatherMap)
-	sabnzbd.Validate(c.SabNZBd)
-	netgear.Validate(c.Netgear)
-	icmp.Validate(c.Icmp)
-	dns.Validate(c.Dns)
+	if c.Probe == nil {
+		c.Probe = probe.NewDefaultConfig()
+	}
 
-	return nil
+	if c.Admin == nil {
+		c.Admin = &AdminConfig{}
+	}
+
+	if err := secret.Resolve(&c.Admin.Token, c.Admin.TokenFile, "admin.token_file"); err != nil {
+		return err
+	}
+
+	if c.Web == nil {
+		c.Web = web.NewDefaultConfig()
+	}
+
+	if c.Textfile == nil {
+		c.Textfile = &TextfileConfig{}
+	}
+
+	if c.Exporters == nil {
+		c.Exporters = map[string]json.RawMessage{}
+	}
+
+	return c.Validate()
+}
+
+// Check the configuration, returning every problem found.
+//
+// Exporter sections are checked by the exporters' own checks, but only
+// for enabled exporters.
+func (c *AppConfig) Validate() error {
+	chk := validate.NewChecker()
+
+	chk.Add(web.ValidateListen(c.Listen))
+	chk.Add(web.Validate(c.Web))
+	chk.Add(validate.Qualify("probe", probe.Validate(c.Probe)))
+
+	if dir := c.Textfile.Directory; dir != "" {
+		if info, err := os.Stat(dir); err != nil {
+			chk.Fail("textfile.directory", "%s", err.Error())
+		} else if !info.IsDir() {
+			chk.Fail("textfile.directory", "'%s' is not a directory", dir)
+		}
+	} else if !c.Textfile.ServeHTTP() {
+		chk.Fail("textfile.http", "cannot be disabled without a directory")
+	}
+
+	if len(c.own) > 0 {
+		own, err := json.Marshal(c.own)
+		if err == nil {
+			chk.Add(validate.UnknownKeys(own, c))
+		}
+	}
+
+	names := []string{}
+	for name := range c.Exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !exporter.Registered(name) {
+			chk.Fail(name, "unknown key")
+		}
+	}
+
+	seen := map[string]bool{}
+	for idx, name := range c.Enabled {
+		path := fmt.Sprintf("enabled[%d]", idx)
+
+		switch {
+		case !exporter.Registered(name):
+			chk.Fail(path, "unknown exporter '%s'", name)
+			continue
+
+		case seen[name]:
+			chk.Fail(path, "duplicate exporter '%s'", name)
+			continue
+		}
+		seen[name] = true
+
+		section, ok := c.Exporters[name]
+		if !ok {
+			chk.Fail(name, "enabled but has no configuration section")
+			continue
+		}
+
+		insts, err := exporter.Instances(name, section)
+		if err != nil {
+			chk.Add(err)
+			continue
+		}
+
+		for _, inst := range insts {
+			chk.Add(exporter.Check(inst))
+		}
+	}
+
+	return chk.Err()
 }
 
 func (c *AppConfig) GetAPIClient() *apiclient.Config {
 	return c.ApiClient
 }
 
+// Return a hash of the configuration as loaded, after merging fragments
+// but before expanding environment variables.
+//
+// The hash is truncated to 48 bits so that it survives being exported
+// as a float.
+func (c *AppConfig) Hash() uint64 {
+	return c.hash
+}
+
+// Return the instance names of each enabled exporter.
+func (c *AppConfig) EnabledInstances() map[string][]string {
+	enabled := map[string][]string{}
+
+	for _, typ := range c.Enabled {
+		insts, err := exporter.Instances(typ, c.Exporters[typ])
+		if err != nil {
+			continue
+		}
+
+		for _, inst := range insts {
+			enabled[typ] = append(enabled[typ], inst.Name)
+		}
+	}
+
+	return enabled
+}
+
+// Return the configuration section for the named exporter.
+func (c *AppConfig) Section(name string) json.RawMessage {
+	return c.Exporters[name]
+}
+
+// Load and initialise the configuration in the given file.
+//
+// The file may be JSON, YAML or TOML, chosen by its extension.  Should
+// it name an include directory, the fragments found there are merged in
+// name order.
+func Load(path string) (*AppConfig, error) {
+	tree, err := readTree(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir, ok := tree["include"].(string); ok && dir != "" {
+		if err := include(tree, path, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	cnf := &AppConfig{}
+	if err := json.Unmarshal(data, cnf); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	if err := cnf.Init(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	cnf.hash = binary.BigEndian.Uint64(sum[:8]) >> 16
+
+	return cnf, nil
+}
+
 /* config.go ends here. */
@@ -0,0 +1,275 @@
+/*
+ * format.go --- Configuration file formats.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package config
+
+import (
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Read a configuration file into a generic tree, choosing the format by
+// the file's extension.
+//
+// Anything that is not YAML or TOML is taken to be JSON, as with the
+// traditional `exporters.conf`.
+func readTree(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree interface{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+
+	case ".toml":
+		tree = map[string]interface{}{}
+		_, err = toml.Decode(string(data), &tree)
+
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&tree)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	// An empty file.
+	if tree == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	obj, ok := normalise(tree).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: configuration is not a mapping", path)
+	}
+
+	return obj, nil
+}
+
+// Convert the maps and lists produced by the decoders into the types
+// that `encoding/json` produces.
+func normalise(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalise(v[k])
+		}
+
+		return v
+
+	case map[interface{}]interface{}:
+		obj := map[string]interface{}{}
+		for k := range v {
+			obj[fmt.Sprintf("%v", k)] = normalise(v[k])
+		}
+
+		return obj
+
+	case []map[string]interface{}:
+		list := []interface{}{}
+		for _, elt := range v {
+			list = append(list, normalise(elt))
+		}
+
+		return list
+
+	case []interface{}:
+		for idx := range v {
+			v[idx] = normalise(v[idx])
+		}
+
+		return v
+	}
+
+	return value
+}
+
+// Is the file one we know how to read?
+func isConfigFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".conf", ".yaml", ".yml", ".toml":
+		return true
+	}
+
+	return false
+}
+
+// Read the fragments in the include directory, in name order, merging
+// each into the tree.
+//
+// A relative directory is relative to the main configuration file.
+func include(tree map[string]interface{}, path, dir string) error {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(path), dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && isConfigFile(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	errs := []error{}
+	for _, name := range names {
+		file := filepath.Join(dir, name)
+
+		frag, err := readTree(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if _, ok := frag["include"]; ok {
+			errs = append(errs, fmt.Errorf("%s: fragments cannot include others", file))
+			continue
+		}
+
+		for _, err := range merge(tree, frag, "") {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func kind(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "a mapping"
+
+	case []interface{}:
+		return "a list"
+	}
+
+	return "a value"
+}
+
+// Merge a fragment into the tree.
+//
+// Mappings are merged key by key, lists are appended to, skipping values
+// already present, and other values in the fragment replace those in the
+// tree.
+func merge(dst, src map[string]interface{}, path string) []error {
+	errs := []error{}
+
+	keys := []string{}
+	for k := range src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := src[k]
+		sub := k
+		if path != "" {
+			sub = path + "." + k
+		}
+
+		old, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		switch o := old.(type) {
+		case map[string]interface{}:
+			if n, ok := v.(map[string]interface{}); ok {
+				errs = append(errs, merge(o, n, sub)...)
+				continue
+			}
+
+		case []interface{}:
+			if n, ok := v.([]interface{}); ok {
+				dst[k] = appendNew(o, n)
+				continue
+			}
+
+		default:
+			if kind(v) == kind(old) {
+				dst[k] = v
+				continue
+			}
+		}
+
+		errs = append(errs, &validate.FieldError{
+			Path: sub,
+			Err:  fmt.Errorf("cannot merge %s into %s", kind(v), kind(old)),
+		})
+	}
+
+	return errs
+}
+
+// Append values to a list, skipping simple values already in it.
+func appendNew(list, values []interface{}) []interface{} {
+	for _, v := range values {
+		dup := false
+
+		if kind(v) == "a value" {
+			for _, o := range list {
+				if o == v {
+					dup = true
+					break
+				}
+			}
+		}
+
+		if !dup {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+/* format.go ends here. */
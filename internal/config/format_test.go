@@ -0,0 +1,221 @@
+/*
+ * format_test.go --- Configuration format and include tests.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package config
+
+import (
+	"github.com/Asmodai/master-exporter/internal/exporter"
+
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func init() {
+	// Sections need an exporter to belong to.
+	exporter.Register("sample", func(*exporter.Deps, *exporter.Instance) (exporter.IExporter, error) {
+		return nil, nil
+	})
+}
+
+// Write files into a directory, creating subdirectories as needed.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, data := range files {
+		file := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  string
+		src  string
+		want string
+		errs []string
+	}{
+		{
+			name: "new keys",
+			dst:  `{"a": 1}`,
+			src:  `{"b": {"c": true}}`,
+			want: `{"a":1,"b":{"c":true}}`,
+		},
+		{
+			name: "values replaced",
+			dst:  `{"a": 1, "b": {"c": "x", "d": "y"}}`,
+			src:  `{"a": 2, "b": {"c": "z"}}`,
+			want: `{"a":2,"b":{"c":"z","d":"y"}}`,
+		},
+		{
+			name: "lists appended",
+			dst:  `{"a": ["x", "y"], "b": [{"n": 1}]}`,
+			src:  `{"a": ["y", "z"], "b": [{"n": 1}]}`,
+			want: `{"a":["x","y","z"],"b":[{"n":1},{"n":1}]}`,
+		},
+		{
+			name: "conflicts",
+			dst:  `{"a": ["x"], "b": {"c": 1}, "d": 1}`,
+			src:  `{"a": "x", "b": {"c": [1]}, "d": {}}`,
+			want: `{"a":["x"],"b":{"c":1},"d":1}`,
+			errs: []string{
+				"a: cannot merge a value into a list",
+				"b.c: cannot merge a list into a value",
+				"d: cannot merge a mapping into a value",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := map[string]interface{}{}
+			src := map[string]interface{}{}
+
+			if err := json.Unmarshal([]byte(tt.dst), &dst); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := json.Unmarshal([]byte(tt.src), &src); err != nil {
+				t.Fatal(err)
+			}
+
+			errs := merge(dst, src, "")
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("errors = %v, want %v", errs, tt.errs)
+			}
+
+			for idx, err := range errs {
+				if err.Error() != tt.errs[idx] {
+					t.Errorf("error %d = %s, want %s", idx, err, tt.errs[idx])
+				}
+			}
+
+			got, err := json.Marshal(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("merged = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadInclude(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"exporters.yml": `
+include: conf.d
+base_port: 9500
+listen: [":9500"]
+probe:
+  modules: {}
+sample:
+  url: http://localhost:8080
+`,
+		"conf.d/10-listen.toml": `
+listen = ["127.0.0.1:9600"]
+`,
+		"conf.d/20-sample.json": `{
+  "sample": {"api_key": "secret"},
+  "base_port": 9600
+}`,
+		"conf.d/README":         "Not a fragment.",
+		"conf.d/sub/30-bad.yml": "base_port: 1",
+	})
+
+	cnf, err := Load(filepath.Join(dir, "exporters.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Later fragments win.
+	if cnf.BasePort != 9600 {
+		t.Errorf("base_port = %d, want 9600", cnf.BasePort)
+	}
+
+	addrs := []string{}
+	for _, l := range cnf.Listen {
+		addrs = append(addrs, l.Address)
+	}
+
+	if got := strings.Join(addrs, ","); got != ":9500,127.0.0.1:9600" {
+		t.Errorf("listen = %s", got)
+	}
+
+	section := map[string]string{}
+	if err := json.Unmarshal(cnf.Section("sample"), &section); err != nil {
+		t.Fatal(err)
+	}
+
+	if section["url"] != "http://localhost:8080" || section["api_key"] != "secret" {
+		t.Errorf("sample = %v", section)
+	}
+}
+
+func TestLoadIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"exporters.json":        `{"include": "conf.d", "listen": [":9500"]}`,
+		"conf.d/10-nested.yml":  "include: more",
+		"conf.d/20-listen.toml": `listen = ":9600"`,
+		"conf.d/30-broken.json": `{`,
+	})
+
+	_, err := Load(filepath.Join(dir, "exporters.json"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	frags := filepath.Join(dir, "conf.d")
+	for _, want := range []string{
+		filepath.Join(frags, "10-nested.yml") + ": fragments cannot include others",
+		filepath.Join(frags, "20-listen.toml") + ": listen: cannot merge a value into a list",
+		filepath.Join(frags, "30-broken.json") + ": ",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+/* format_test.go ends here. */
@@ -30,37 +30,56 @@
 package dns
 
 import (
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/metrics"
+
 	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"context"
+	"errors"
 	"net"
+	"sync"
 	"time"
 )
 
+var (
+	// Hosts looked up at once.
+	dnsWorkers int = 8
+)
+
 type Exporter struct {
+	sync.Mutex
+
 	ctx     context.Context
 	logger  logger.ILogger
 	config  *Config
-	metrics *Metrics
+	metrics *metrics.Labelled
+	breaker *exporter.Breaker
+	stale   *exporter.TargetStaleness
 	calls   int
 }
 
-func NewExporter(ctx context.Context, logger logger.ILogger, config *Config) *Exporter {
+func NewExporter(ctx context.Context, logger logger.ILogger, reg prometheus.Registerer, breaker *exporter.Breaker, stale *exporter.Staleness, config *Config) (*Exporter, error) {
+	metrics, err := NewMetrics(reg)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Exporter{
 		ctx:     ctx,
 		logger:  logger,
 		config:  config,
-		metrics: NewMetrics(),
+		metrics: metrics,
+		breaker: breaker,
+		stale:   exporter.NewTargetStaleness(stale),
 		calls:   0,
-	}
+	}, nil
 }
 
-func (e *Exporter) lookup(host string) (error, time.Duration) {
+func (e *Exporter) lookup(ctx context.Context, host string) (error, time.Duration) {
 	var r *net.Resolver
 
-	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*5)
-	defer cancel()
-
 	start := time.Now()
 	if _, err := r.LookupHost(ctx, host); err != nil {
 		e.logger.Warn(
@@ -79,30 +98,121 @@ func (e *Exporter) Interval() int {
 	return e.config.Interval
 }
 
-func (e *Exporter) Setup() error {
-	for _, h := range e.config.Hosts {
-		if c := e.metrics.HasHost(h); !c {
-			m := e.metrics.GetHost(h)
+func (e *Exporter) Timeout() int {
+	return e.config.Timeout
+}
 
-			m.AddMetric("response_time", "DNS query response time. Nanoseconds.", h)
-		}
+// Look up a single host, returning how long it took.
+//
+// A host whose circuit is open is passed over.
+func (e *Exporter) probe(ctx context.Context, host string) (time.Duration, error) {
+	if err := e.breaker.Allow(host); err != nil {
+		return 0, err
 	}
 
-	return nil
+	err, res := e.lookup(ctx, host)
+	e.breaker.Done(host, err)
+
+	return res, err
 }
 
-func (e *Exporter) Scrape() error {
-	for _, h := range e.config.Hosts {
-		err, res := e.lookup(h)
-		if err != nil {
+// Look up the hosts, several at a time.
+//
+// Each host gets its share of the scrape's deadline, and one that runs
+// out of time has failed like any other.  The scrape only fails if no
+// host could be looked up, so that one failing name does not take the
+// others with it.
+func (e *Exporter) Scrape(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+
+	hosts := e.config.Hosts
+	times := make([]time.Duration, len(hosts))
+	errs := exporter.EachTarget(ctx, hosts, dnsWorkers,
+		func(ctx context.Context, idx int, host string) (err error) {
+			times[idx], err = e.probe(ctx, host)
+
 			return err
+		})
+
+	failed := []error{}
+	for idx, h := range hosts {
+		err := errs[idx]
+		stale, drop := e.stale.Track(h, err)
+
+		if stale {
+			e.metrics.Set("up", 0, h)
+		} else {
+			e.metrics.Set("up", 1, h)
+		}
+
+		if err != nil {
+			if drop {
+				e.metrics.RemoveMetrics(h, "response_time")
+			}
+
+			failed = append(failed, err)
+			continue
 		}
 
-		m := e.metrics.GetHost(h)
-		m.SetMetric("response_time", float64(res))
+		e.metrics.Set("response_time", float64(times[idx]), h)
 	}
 
+	if len(failed) == len(hosts) {
+		return errors.Join(failed...)
+	}
+
+	return exporter.TargetPanics(errs)
+}
+
+// Apply a new configuration, forgetting hosts that are gone.
+func (e *Exporter) Reload(inst *exporter.Instance) error {
+	cnf, err := decodeConfig(inst)
+	if err != nil {
+		return err
+	}
+
+	bcnf, err := exporter.ParseBreaker(inst)
+	if err != nil {
+		return err
+	}
+
+	stale, err := exporter.ParseStaleness(inst)
+	if err != nil {
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.config = cnf
+	e.metrics.Retain(cnf.Hosts)
+	e.breaker.SetConfig(bcnf)
+	e.breaker.Retain(cnf.Hosts)
+	e.stale.SetConfig(stale)
+	e.stale.Retain(cnf.Hosts)
+
 	return nil
 }
 
+// Delete the response times until the next successful scrape.
+//
+// Every host is down by now, which `up` still shows.
+func (e *Exporter) Drop() {
+	e.Lock()
+	defer e.Unlock()
+
+	for _, h := range e.metrics.Targets() {
+		e.metrics.RemoveMetrics(h, "response_time")
+	}
+}
+
+func (e *Exporter) Close() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.metrics.Unregister()
+	e.breaker.Close()
+}
+
 /* exporter.go ends here. */
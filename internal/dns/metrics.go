@@ -30,85 +30,22 @@
 package dns
 
 import (
+	"github.com/Asmodai/master-exporter/internal/metrics"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-type DnsMetrics struct {
-	Metric map[string]prometheus.Gauge
-}
-
-func NewDnsMetrics() *DnsMetrics {
-	return &DnsMetrics{
-		Metric: map[string]prometheus.Gauge{},
-	}
-}
-
-func (dm *DnsMetrics) AddMetric(name, help, pretty string) {
-	if dm.Metric == nil {
-		dm.Metric = map[string]prometheus.Gauge{}
-	}
-
-	if _, ok := dm.Metric[name]; !ok {
-		dm.Metric[name] = prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: "dns",
-			Name:      name,
-			Help:      help,
-			ConstLabels: map[string]string{
-				"host": pretty,
-			},
-		})
-		_ = prometheus.Register(dm.Metric[name])
-	}
-}
+// Create the metrics for an exporter, labelled by host.
+func NewMetrics(reg prometheus.Registerer) (*metrics.Labelled, error) {
+	m := metrics.NewLabelled(reg, "dns", "host")
+	m.Gauge("up", "Is the host's data fresh?")
+	m.Gauge("response_time", "DNS query response time. Nanoseconds.")
 
-func (dm *DnsMetrics) SetMetric(name string, value float64) {
-	if _, ok := dm.Metric[name]; !ok {
-		return
+	if err := m.Err(); err != nil {
+		return nil, err
 	}
 
-	dm.Metric[name].Set(value)
-}
-
-// =================================================================
-
-type Metrics struct {
-	metrics map[string]*DnsMetrics
-}
-
-func NewMetrics() *Metrics {
-	return &Metrics{
-		metrics: map[string]*DnsMetrics{},
-	}
-}
-
-func (m *Metrics) Keys() []string {
-	keys := []string{}
-
-	for k := range m.metrics {
-		keys = append(keys, k)
-	}
-
-	return keys
-}
-
-func (m *Metrics) HasHost(key string) bool {
-	_, ok := m.metrics[key]
-
-	return ok
-}
-
-func (m *Metrics) AddHost(key string) {
-	if _, ok := m.metrics[key]; ok {
-		return
-	}
-
-	m.metrics[key] = NewDnsMetrics()
-}
-
-func (m *Metrics) GetHost(key string) *DnsMetrics {
-	m.AddHost(key)
-
-	return m.metrics[key]
+	return m, nil
 }
 
 /* metrics.go ends here. */
@@ -1,7 +1,7 @@
 /*
- * dns.go --- DNS resolver exporter.
+ * probe.go --- DNS prober.
  *
- * Copyright (c) 2022-2024 Paul Ward <asmodai@gmail.com>
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
  *
  * Author:     Paul Ward <asmodai@gmail.com>
  * Maintainer: Paul Ward <asmodai@gmail.com>
@@ -27,51 +27,42 @@
  * SOFTWARE.
  */
 
-package main
+package dns
 
 import (
-	"github.com/Asmodai/gohacks/utils"
+	"github.com/Asmodai/master-exporter/internal/probe"
 
-	"github.com/Asmodai/master-exporter/internal/config"
-	"github.com/Asmodai/master-exporter/internal/dns"
-	"github.com/Asmodai/master-exporter/internal/exporter"
-)
-
-func (m *MasterExporter) initDns() {
-	cnf := m.config.AppConfig.(*config.AppConfig)
+	"github.com/Asmodai/gohacks/logger"
 
-	if !utils.Member(cnf.Enabled, "dns") {
-		return
-	}
+	"github.com/prometheus/client_golang/prometheus"
 
-	exp := dns.NewExporter(
-		m.appl.Context(),
-		m.appl.Logger(),
-		cnf.Dns,
-	)
+	"context"
+)
 
-	if err := exp.Setup(); err != nil {
-		panic(err.Error())
-	}
-	if err := exp.Scrape(); err != nil {
-		panic(err.Error())
-	}
-	m.config.Logger.Info(
-		"Initial scrape complete.",
-		"exporter", "dns",
-	)
+func init() {
+	probe.Register("dns", Probe)
+}
 
-	params := exporter.NewParams(
-		"dns",
-		exp,
-		m.config.ProcessManager,
-		m.config.Logger,
-	)
+// Resolve a single target.
+//
+// The module's timeout has already been applied to the context.
+func Probe(ctx context.Context, _ *probe.Module, target string, reg prometheus.Registerer, lgr logger.ILogger) error {
+	e := &Exporter{logger: lgr}
 
-	_, err := exporter.Spawn(params)
+	err, res := e.lookup(ctx, target)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "dns",
+		Name:      "response_time",
+		Help:      "DNS query response time. Nanoseconds.",
+	})
+	reg.MustRegister(gauge)
+	gauge.Set(float64(res))
+
+	return nil
 }
 
-/* dns.go ends here. */
+/* probe.go ends here. */
@@ -1,7 +1,7 @@
 /*
- * openweathermap.go --- OpenWeatherMap exporter.
+ * apiclient.go --- Context-aware API client calls.
  *
- * Copyright (c) 2022-2024 Paul Ward <asmodai@gmail.com>
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
  *
  * Author:     Paul Ward <asmodai@gmail.com>
  * Maintainer: Paul Ward <asmodai@gmail.com>
@@ -27,49 +27,43 @@
  * SOFTWARE.
  */
 
-package main
+package exporter
 
 import (
-	"github.com/Asmodai/gohacks/utils"
+	"github.com/Asmodai/master-exporter/internal/secret"
 
-	"github.com/Asmodai/master-exporter/internal/config"
-	"github.com/Asmodai/master-exporter/internal/exporter"
-	"github.com/Asmodai/master-exporter/internal/openweathermap"
-)
+	"github.com/Asmodai/gohacks/apiclient"
 
-func (m *MasterExporter) initOMW() {
-	cnf := m.config.AppConfig.(*config.AppConfig)
+	"context"
+)
 
-	if !utils.Member(cnf.Enabled, "openweathermap") {
-		return
-	}
+type apiResult struct {
+	data []byte
+	code int
+	err  error
+}
 
-	exp := openweathermap.NewExporter(
-		m.apic,
-		m.config.Logger,
-		cnf.OpenWeatherMap,
-	)
+// Perform a HTTP GET that gives up once the context is done.
+//
+// The API client has no notion of contexts, so the request itself is
+// left to run out its own timeout in the background.
+//
+// Errors can contain the URL, so any credentials in it are redacted.
+func Get(ctx context.Context, client apiclient.IApiClient, params *apiclient.Params) ([]byte, int, error) {
+	res := make(chan apiResult, 1)
 
-	// Scrape now
-	if err := exp.Scrape(); err != nil {
-		panic(err.Error())
-	}
-	m.config.Logger.Info(
-		"Initial scrape complete.",
-		"exporter", "openweathermap",
-	)
+	go func() {
+		data, code, err := client.Get(params)
+		res <- apiResult{data: data, code: code, err: err}
+	}()
 
-	params := exporter.NewParams(
-		"openweathermap",
-		exp,
-		m.config.ProcessManager,
-		m.config.Logger,
-	)
+	select {
+	case r := <-res:
+		return r.data, r.code, secret.RedactError(r.err)
 
-	_, err := exporter.Spawn(params)
-	if err != nil {
-		panic(err.Error())
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
 	}
 }
 
-/* openweathermap.go ends here. */
+/* apiclient.go ends here. */
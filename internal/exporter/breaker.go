@@ -0,0 +1,350 @@
+/*
+ * breaker.go --- Circuit breaker.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"    // Calls go ahead.
+	BreakerHalfOpen = "half-open" // A single call is let through to probe.
+	BreakerOpen     = "open"      // Calls are refused until the next probe.
+
+	breakerHelp = "State of the circuit breaker: 0 closed, 1 half-open, 2 open."
+)
+
+var breakerValues = map[string]float64{
+	BreakerClosed:   0,
+	BreakerHalfOpen: 1,
+	BreakerOpen:     2,
+}
+
+// When to stop calling a target that keeps failing.
+//
+// The circuit opens after `Failures` failures in a row, zero meaning
+// never.  It is probed after `Backoff` seconds, and each failed probe
+// doubles the wait, up to `MaxBackoff` seconds.
+type BreakerConfig struct {
+	Failures   int `json:"failures"`
+	Backoff    int `json:"backoff"`
+	MaxBackoff int `json:"max_backoff"`
+}
+
+func NewDefaultBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		Failures:   3,
+		Backoff:    30,
+		MaxBackoff: 600,
+	}
+}
+
+// Read the circuit breaker settings from an instance's `breaker` key.
+func ParseBreaker(inst *Instance) (*BreakerConfig, error) {
+	section := struct {
+		Breaker *BreakerConfig `json:"breaker"`
+	}{
+		Breaker: NewDefaultBreakerConfig(),
+	}
+
+	// The rest of the section belongs to the exporter.
+	if len(inst.Config) > 0 {
+		if err := json.Unmarshal(inst.Config, &section); err != nil {
+			return nil, validate.Qualify(
+				inst.ProcessName(),
+				&validate.FieldError{Path: "breaker", Err: err},
+			)
+		}
+	}
+
+	cnf := section.Breaker
+	if cnf == nil {
+		cnf = NewDefaultBreakerConfig()
+	}
+
+	c := validate.NewChecker()
+	c.AtLeast("failures", cnf.Failures, 0)
+	c.Positive("backoff", cnf.Backoff)
+	c.AtLeast("max_backoff", cnf.MaxBackoff, cnf.Backoff)
+
+	if err := c.Err(); err != nil {
+		return nil, validate.Qualify(
+			inst.ProcessName(),
+			validate.Qualify("breaker", err),
+		)
+	}
+
+	return cnf, nil
+}
+
+// Returned when a call is refused because the circuit is open.
+type BreakerError struct {
+	Target string
+	Retry  time.Time
+}
+
+func (e *BreakerError) Error() string {
+	if e.Target == "" {
+		return fmt.Sprintf(
+			"Circuit open until %s.",
+			e.Retry.Format(time.RFC3339),
+		)
+	}
+
+	return fmt.Sprintf(
+		"Circuit for '%s' open until %s.",
+		e.Target,
+		e.Retry.Format(time.RFC3339),
+	)
+}
+
+func (e *BreakerError) Class() string { return ClassBreaker }
+
+type circuit struct {
+	state    string
+	failures int
+	wait     time.Duration
+	retry    time.Time
+}
+
+// Tracks failures per target, and stops calling targets that keep on
+// failing.
+//
+// An exporter as a whole is the target "".  Callers ask `Allow` before
+// each call and report the outcome with `Done`.
+type Breaker struct {
+	sync.Mutex
+
+	name     string
+	cnf      *BreakerConfig
+	lgr      logger.ILogger
+	gauge    *prometheus.GaugeVec
+	lvs      []string
+	reg      prometheus.Registerer
+	circuits map[string]*circuit
+}
+
+// Create a breaker that reports its state in the given gauge, whose
+// labels are `lvs` followed by the target.
+func NewBreaker(name string, cnf *BreakerConfig, lgr logger.ILogger, gauge *prometheus.GaugeVec, lvs ...string) *Breaker {
+	return &Breaker{
+		name:     name,
+		cnf:      cnf,
+		lgr:      lgr,
+		gauge:    gauge,
+		lvs:      lvs,
+		circuits: map[string]*circuit{},
+	}
+}
+
+// Create a breaker for an exporter's own targets, such as hosts.
+//
+// Its state metric is registered with the exporter's registerer, and is
+// unregistered again by `Close`.
+func NewTargetBreaker(deps *Deps, inst *Instance, cnf *BreakerConfig) (*Breaker, error) {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "master_exporter",
+		Name:      "breaker_state",
+		Help:      breakerHelp,
+	}, []string{"exporter", "target"})
+
+	if err := deps.Registerer.Register(gauge); err != nil {
+		return nil, err
+	}
+
+	b := NewBreaker(inst.ProcessName(), cnf, deps.Logger, gauge, inst.Type)
+	b.reg = deps.Registerer
+
+	return b, nil
+}
+
+// Apply new settings.  Should the breaker have been disabled, every
+// circuit is closed.
+func (b *Breaker) SetConfig(cnf *BreakerConfig) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.cnf = cnf
+
+	if cnf.Failures == 0 {
+		for target, c := range b.circuits {
+			c.state = BreakerClosed
+			c.failures = 0
+			c.wait = 0
+			b.set(target, c)
+		}
+	}
+}
+
+// May the target be called now?
+//
+// Once an open circuit's wait is over, it goes half-open and the call
+// goes ahead as a probe.
+func (b *Breaker) Allow(target string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	c := b.circuit(target)
+	if c.state != BreakerOpen {
+		return nil
+	}
+
+	if time.Now().Before(c.retry) {
+		return &BreakerError{Target: target, Retry: c.retry}
+	}
+
+	c.state = BreakerHalfOpen
+	b.set(target, c)
+
+	return nil
+}
+
+// Record the outcome of a call to the target.
+func (b *Breaker) Done(target string, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	c := b.circuit(target)
+
+	if err == nil {
+		if c.state != BreakerClosed {
+			b.lgr.Info(
+				"Circuit closed.",
+				"exporter", b.name,
+				"target", target,
+			)
+		}
+
+		c.state = BreakerClosed
+		c.failures = 0
+		c.wait = 0
+		b.set(target, c)
+
+		return
+	}
+
+	c.failures++
+
+	switch {
+	case c.state == BreakerHalfOpen:
+		c.wait *= 2
+		if limit := time.Duration(b.cnf.MaxBackoff) * time.Second; c.wait > limit {
+			c.wait = limit
+		}
+		b.open(target, c)
+
+	case c.state == BreakerClosed && b.cnf.Failures > 0 && c.failures >= b.cnf.Failures:
+		c.wait = time.Duration(b.cnf.Backoff) * time.Second
+		b.open(target, c)
+	}
+}
+
+// Return the state of the target's circuit.
+func (b *Breaker) State(target string) string {
+	b.Lock()
+	defer b.Unlock()
+
+	if c, ok := b.circuits[target]; ok {
+		return c.state
+	}
+
+	return BreakerClosed
+}
+
+// Forget targets that are not in the given list.
+func (b *Breaker) Retain(targets []string) {
+	b.Lock()
+	defer b.Unlock()
+
+	keep := map[string]bool{}
+	for _, target := range targets {
+		keep[target] = true
+	}
+
+	for target := range b.circuits {
+		if !keep[target] {
+			b.gauge.DeleteLabelValues(b.labels(target)...)
+			delete(b.circuits, target)
+		}
+	}
+}
+
+// Forget every target, unregistering the state metric if we registered
+// it ourselves.
+func (b *Breaker) Close() {
+	b.Retain([]string{})
+
+	if b.reg != nil {
+		b.reg.Unregister(b.gauge)
+	}
+}
+
+func (b *Breaker) circuit(target string) *circuit {
+	c, ok := b.circuits[target]
+	if !ok {
+		c = &circuit{state: BreakerClosed}
+		b.circuits[target] = c
+		b.set(target, c)
+	}
+
+	return c
+}
+
+func (b *Breaker) open(target string, c *circuit) {
+	c.state = BreakerOpen
+	c.retry = time.Now().Add(c.wait)
+	b.set(target, c)
+
+	b.lgr.Warn(
+		"Circuit opened.",
+		"exporter", b.name,
+		"target", target,
+		"failures", c.failures,
+		"retry", c.wait.String(),
+	)
+}
+
+func (b *Breaker) labels(target string) []string {
+	return append(append([]string{}, b.lvs...), target)
+}
+
+func (b *Breaker) set(target string, c *circuit) {
+	b.gauge.WithLabelValues(b.labels(target)...).Set(breakerValues[c.state])
+}
+
+/* breaker.go ends here. */
@@ -0,0 +1,294 @@
+/*
+ * breaker_test.go --- Tests for circuit breakers.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errFailed = errors.New("failed")
+
+func newTestBreaker(t *testing.T, cnf *BreakerConfig) (*Breaker, *prometheus.Registry) {
+	t.Helper()
+
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "breaker_state",
+		Help: breakerHelp,
+	}, []string{"exporter", "target"})
+
+	if err := reg.Register(gauge); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewBreaker("test", cnf, logger.NewDefaultLogger(), gauge, "test"), reg
+}
+
+// Pretend the target's wait is over.
+func expire(b *Breaker, target string) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.circuits[target].retry = time.Now().Add(-time.Second)
+}
+
+// Return the state gauge of each target.
+func gauges(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			found[target(m)] = m.GetGauge().GetValue()
+		}
+	}
+
+	return found
+}
+
+func target(m *dto.Metric) string {
+	for _, lp := range m.GetLabel() {
+		if lp.GetName() == "target" {
+			return lp.GetValue()
+		}
+	}
+
+	return ""
+}
+
+func TestParseBreaker(t *testing.T) {
+	def := NewDefaultBreakerConfig()
+
+	tests := []struct {
+		name    string
+		config  string
+		want    *BreakerConfig
+		wantErr bool
+	}{
+		{"no section", "", def, false},
+		{"no breaker", `{"interval":10}`, def, false},
+		{"null breaker", `{"breaker":null}`, def, false},
+		{"partial", `{"breaker":{"failures":5}}`, &BreakerConfig{5, 30, 600}, false},
+		{"full", `{"breaker":{"failures":1,"backoff":10,"max_backoff":10}}`, &BreakerConfig{1, 10, 10}, false},
+		{"disabled", `{"breaker":{"failures":0}}`, &BreakerConfig{0, 30, 600}, false},
+		{"negative failures", `{"breaker":{"failures":-1}}`, nil, true},
+		{"zero backoff", `{"breaker":{"backoff":0}}`, nil, true},
+		{"max below backoff", `{"breaker":{"backoff":60,"max_backoff":30}}`, nil, true},
+		{"wrong type", `{"breaker":{"failures":"many"}}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst := &Instance{Type: "test", Name: "test", Config: json.RawMessage(tt.config)}
+
+			got, err := ParseBreaker(inst)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBreaker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && *got != *tt.want {
+				t.Errorf("ParseBreaker() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		expire bool  // Let the wait run out first.
+		allow  bool  // Whether the call should be allowed.
+		err    error // Outcome of the call, if allowed.
+		state  string
+	}
+
+	tests := []struct {
+		name  string
+		cnf   *BreakerConfig
+		steps []step
+	}{
+		{
+			name: "opens after failures",
+			cnf:  &BreakerConfig{Failures: 2, Backoff: 30, MaxBackoff: 600},
+			steps: []step{
+				{allow: true, err: errFailed, state: BreakerClosed},
+				{allow: true, err: errFailed, state: BreakerOpen},
+				{allow: false, state: BreakerOpen},
+			},
+		},
+		{
+			name: "success resets failures",
+			cnf:  &BreakerConfig{Failures: 2, Backoff: 30, MaxBackoff: 600},
+			steps: []step{
+				{allow: true, err: errFailed, state: BreakerClosed},
+				{allow: true, err: nil, state: BreakerClosed},
+				{allow: true, err: errFailed, state: BreakerClosed},
+			},
+		},
+		{
+			name: "probe succeeds",
+			cnf:  &BreakerConfig{Failures: 1, Backoff: 30, MaxBackoff: 600},
+			steps: []step{
+				{allow: true, err: errFailed, state: BreakerOpen},
+				{expire: true, allow: true, err: nil, state: BreakerClosed},
+				{allow: true, err: nil, state: BreakerClosed},
+			},
+		},
+		{
+			name: "probe fails",
+			cnf:  &BreakerConfig{Failures: 1, Backoff: 30, MaxBackoff: 600},
+			steps: []step{
+				{allow: true, err: errFailed, state: BreakerOpen},
+				{expire: true, allow: true, err: errFailed, state: BreakerOpen},
+				{allow: false, state: BreakerOpen},
+			},
+		},
+		{
+			name: "disabled",
+			cnf:  &BreakerConfig{Failures: 0, Backoff: 30, MaxBackoff: 600},
+			steps: []step{
+				{allow: true, err: errFailed, state: BreakerClosed},
+				{allow: true, err: errFailed, state: BreakerClosed},
+				{allow: true, err: errFailed, state: BreakerClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, reg := newTestBreaker(t, tt.cnf)
+
+			for idx, st := range tt.steps {
+				if st.expire {
+					expire(b, "host")
+				}
+
+				err := b.Allow("host")
+				if (err == nil) != st.allow {
+					t.Fatalf("step %d: Allow() error = %v, want allowed %v", idx, err, st.allow)
+				}
+
+				if err != nil {
+					var berr *BreakerError
+					if !errors.As(err, &berr) || berr.Target != "host" {
+						t.Errorf("step %d: Allow() error = %#v", idx, err)
+					}
+
+					if Classify(err) != ClassBreaker {
+						t.Errorf("step %d: class = %s", idx, Classify(err))
+					}
+				} else {
+					b.Done("host", st.err)
+				}
+
+				if got := b.State("host"); got != st.state {
+					t.Errorf("step %d: State() = %s, want %s", idx, got, st.state)
+				}
+
+				if got := gauges(t, reg)["host"]; got != breakerValues[st.state] {
+					t.Errorf("step %d: gauge = %v, want %v", idx, got, breakerValues[st.state])
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerBackoff(t *testing.T) {
+	b, _ := newTestBreaker(t, &BreakerConfig{Failures: 1, Backoff: 10, MaxBackoff: 35})
+
+	_ = b.Allow("host")
+	b.Done("host", errFailed)
+
+	for idx, want := range []time.Duration{20, 35, 35} {
+		expire(b, "host")
+
+		if err := b.Allow("host"); err != nil {
+			t.Fatalf("probe %d: %v", idx, err)
+		}
+
+		if got := b.State("host"); got != BreakerHalfOpen {
+			t.Errorf("probe %d: State() = %s, want %s", idx, got, BreakerHalfOpen)
+		}
+
+		b.Done("host", errFailed)
+
+		if got := b.circuits["host"].wait; got != want*time.Second {
+			t.Errorf("probe %d: wait = %s, want %s", idx, got, want*time.Second)
+		}
+	}
+}
+
+func TestBreakerTargets(t *testing.T) {
+	b, reg := newTestBreaker(t, &BreakerConfig{Failures: 1, Backoff: 30, MaxBackoff: 600})
+
+	for _, host := range []string{"a", "b", "c"} {
+		_ = b.Allow(host)
+		b.Done(host, fmt.Errorf("%s failed", host))
+	}
+
+	if err := b.Allow("a"); err == nil {
+		t.Error("circuit for a is not open")
+	}
+
+	b.Retain([]string{"a"})
+
+	if got := gauges(t, reg); len(got) != 1 || got["a"] != breakerValues[BreakerOpen] {
+		t.Errorf("gauges after Retain = %v", got)
+	}
+
+	if got := b.State("b"); got != BreakerClosed {
+		t.Errorf("forgotten target State() = %s, want %s", got, BreakerClosed)
+	}
+
+	// Disabling the breaker closes every circuit.
+	b.SetConfig(&BreakerConfig{Failures: 0, Backoff: 30, MaxBackoff: 600})
+	if err := b.Allow("a"); err != nil {
+		t.Errorf("Allow() after disabling = %v", err)
+	}
+
+	b.Close()
+	if got := gauges(t, reg); len(got) != 0 {
+		t.Errorf("gauges after Close = %v", got)
+	}
+}
+
+/* breaker_test.go ends here. */
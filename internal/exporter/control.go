@@ -0,0 +1,229 @@
+/*
+ * control.go --- Runtime control of exporter instances.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotFound = errors.New("No such exporter")
+	ErrBadState = errors.New("Exporter cannot do that in its current state")
+)
+
+// Return the status of a member.
+func (m *member) status() *Status {
+	if m.exp != nil {
+		st := m.exp.Status()
+		if m.state != StateRunning {
+			st.State = m.state
+		}
+
+		return st
+	}
+
+	return &Status{
+		Name:     m.inst.ProcessName(),
+		Exporter: m.inst.Type,
+		Instance: m.inst.Name,
+		State:    m.state,
+		Interval: float64(m.obj.Interval()),
+		Timeout:  float64(ScrapeTimeout(m.obj)),
+		Last:     m.last,
+	}
+}
+
+// Stop the member's process, if it has one.
+func (m *member) halt() {
+	if m.proc != nil {
+		m.proc.Stop()
+		m.proc = nil
+	}
+}
+
+func (p *Pool) member(name string) (*member, error) {
+	m, ok := p.members[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrNotFound, name)
+	}
+
+	return m, nil
+}
+
+func badState(m *member) error {
+	return fmt.Errorf("%w: '%s' is %s", ErrBadState, m.inst.ProcessName(), m.state)
+}
+
+// Return the status of the named instance.
+func (p *Pool) StatusOf(name string) (*Status, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	m, err := p.member(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.status(), nil
+}
+
+// Scrape the named instance right now.
+//
+// A paused instance stays paused, and an instance that is retrying its
+// initial scrape is started if the scrape succeeds.
+func (p *Pool) Trigger(name string) (*Result, error) {
+	p.Lock()
+	m, err := p.member(name)
+	if err != nil {
+		p.Unlock()
+
+		return nil, err
+	}
+
+	// Scrape without holding the lock; it may take a while.
+	exp := m.exp
+	p.Unlock()
+
+	if exp != nil {
+		return exp.run(p.deps.Context), nil
+	}
+
+	res, err := p.initial(p.deps.Context, m)
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.members[name] != m || m.state != StateRetrying {
+		// Stopped or started while we were scraping.
+		return res, nil
+	}
+
+	m.last = res
+	m.err = err
+
+	if err == nil {
+		p.run(m)
+	}
+
+	return res, nil
+}
+
+// Stop scraping the named instance periodically.
+func (p *Pool) Pause(name string) (*Status, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	m, err := p.member(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.state != StateRunning {
+		return nil, badState(m)
+	}
+
+	m.halt()
+	m.state = StatePaused
+
+	p.lgr.Info(
+		"Exporter paused.",
+		"exporter", m.inst.Type,
+		"instance", m.inst.Name,
+	)
+
+	return m.status(), nil
+}
+
+// Resume periodic scraping of the named instance.
+func (p *Pool) Resume(name string) (*Status, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	m, err := p.member(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.state != StatePaused {
+		return nil, badState(m)
+	}
+
+	m.proc = respawn(p.mgr, m.exp)
+	m.state = StateRunning
+
+	p.lgr.Info(
+		"Exporter resumed.",
+		"exporter", m.inst.Type,
+		"instance", m.inst.Name,
+	)
+
+	return m.status(), nil
+}
+
+// Change the scrape interval of the named instance.
+//
+// The new interval lasts until the configuration is next reloaded.
+func (p *Pool) SetInterval(name string, interval int) (*Status, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("Interval must be positive, not %d", interval)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	m, err := p.member(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.exp == nil {
+		return nil, badState(m)
+	}
+
+	m.exp.setInterval(interval)
+
+	// A process's interval is fixed once it is running.
+	if m.state == StateRunning {
+		m.halt()
+		m.proc = respawn(p.mgr, m.exp)
+	}
+
+	p.lgr.Info(
+		"Exporter interval changed.",
+		"exporter", m.inst.Type,
+		"instance", m.inst.Name,
+		"interval", interval,
+	)
+
+	return m.status(), nil
+}
+
+/* control.go ends here. */
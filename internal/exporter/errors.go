@@ -0,0 +1,104 @@
+/*
+ * errors.go --- Scrape error classes.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+)
+
+const (
+	ClassTimeout string = "timeout"
+	ClassNetwork string = "network"
+	ClassHTTP    string = "http"
+	ClassDecode  string = "decode"
+	ClassLimit   string = "limit"
+	ClassPanic   string = "panic"
+	ClassBreaker string = "breaker"
+	ClassOther   string = "other"
+)
+
+// Returned, possibly wrapped, by collectors that choose not to fetch
+// anything this time round, such as when their data cannot yet have
+// changed.  A skipped scrape is neither a success nor a failure.
+var ErrSkipped = errors.New("Scrape skipped")
+
+// Errors that know their own class.
+type IClassError interface {
+	Class() string
+}
+
+type Error struct {
+	class string
+	err   error
+}
+
+func NewError(class string, err error) *Error {
+	return &Error{
+		class: class,
+		err:   err,
+	}
+}
+
+func (e *Error) Error() string { return e.err.Error() }
+func (e *Error) Unwrap() error { return e.err }
+func (e *Error) Class() string { return e.class }
+
+// Work out the class of the given error for the `class` label.
+func Classify(err error) string {
+	var classed IClassError
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &classed):
+		return classed.Class()
+
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassTimeout
+
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ClassTimeout
+		}
+
+		return ClassNetwork
+
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ClassDecode
+	}
+
+	return ClassOther
+}
+
+/* errors.go ends here. */
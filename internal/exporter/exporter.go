@@ -32,29 +32,278 @@ package exporter
 import (
 	"github.com/Asmodai/gohacks/logger"
 	"github.com/Asmodai/gohacks/process"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
 )
 
 type Exporter struct {
-	name string
-	obj  IExporter
-	lgr  logger.ILogger
+	name    string
+	inst    *Instance
+	obj     IExporter
+	lgr     logger.ILogger
+	metrics *Metrics
+	timeout atomic.Int64
+	busy    atomic.Bool
+
+	stale    atomic.Pointer[Staleness]
+	breaker  *Breaker
+	failures atomic.Int64
+	updated  atomic.Int64
+
+	started  atomic.Int64
+	last     atomic.Pointer[Result]
+	interval atomic.Int64
+
+	gatherer prometheus.Gatherer
+	textfile string
+
+	// Where to write the health of every instance, if anywhere.
+	health     prometheus.Gatherer
+	healthfile string
+
+	// Called after a recovered panic, so that the exporter can be
+	// restarted.
+	onPanic func(*Exporter, error)
+}
+
+func NewExporter(inst *Instance, obj IExporter, metrics *Metrics, lgr logger.ILogger) *Exporter {
+	e := &Exporter{
+		name:    inst.ProcessName(),
+		inst:    inst,
+		obj:     obj,
+		lgr:     lgr,
+		metrics: metrics,
+	}
+	e.updateTimeout()
+	e.updated.Store(time.Now().UnixNano())
+
+	if err := e.updateStaleness(inst); err != nil {
+		e.stale.Store(NewDefaultStaleness())
+	}
+
+	cnf, err := ParseBreaker(inst)
+	if err != nil {
+		cnf = NewDefaultBreakerConfig()
+	}
+	e.breaker = NewBreaker(e.name, cnf, lgr, metrics.Breaker, inst.Type, inst.Name)
+
+	return e
+}
+
+// Scrape with the exporter's deadline applied to the given context.
+//
+// Collectors are expected to honour the context, but should one not do
+// so then we give up waiting on it once the deadline passes.  The
+// abandoned scrape is left to finish in the background, and no further
+// scrapes are started until it has.
+func (e *Exporter) Scrape(parent context.Context) error {
+	if !e.busy.CompareAndSwap(false, true) {
+		return NewError(
+			ClassTimeout,
+			fmt.Errorf("Previous scrape is still running."),
+		)
+	}
+	e.started.Store(time.Now().UnixNano())
+
+	ctx, cancel := context.WithTimeout(
+		parent,
+		time.Duration(e.timeout.Load()),
+	)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer e.busy.Store(false)
+
+		done <- safeScrape(ctx, e.obj)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Perform a one-off scrape outside of a process, honouring the timeout.
+func ScrapeNow(ctx context.Context, obj IExporter) error {
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(ScrapeTimeout(obj))*time.Second,
+	)
+	defer cancel()
+
+	return safeScrape(ctx, obj)
+}
+
+// Return the scrape interval, which may have been overridden at runtime.
+func (e *Exporter) Interval() int {
+	if interval := e.interval.Load(); interval > 0 {
+		return int(interval)
+	}
+
+	return e.obj.Interval()
+}
+
+func (e *Exporter) Timeout() int {
+	return e.obj.Timeout()
+}
+
+// Override the configured interval; zero reverts to the configuration.
+func (e *Exporter) setInterval(interval int) {
+	e.interval.Store(int64(interval))
+	e.updateTimeout()
+}
+
+// Update the scrape deadline from the exporter's configuration.
+func (e *Exporter) updateTimeout() {
+	timeout := time.Duration(ScrapeTimeout(e)) * time.Second
+
+	e.timeout.Store(int64(timeout))
+}
+
+// Update the staleness policy from the instance's configuration.
+func (e *Exporter) updateStaleness(inst *Instance) error {
+	stale, err := ParseStaleness(inst)
+	if err != nil {
+		return err
+	}
+
+	e.stale.Store(stale)
+
+	return nil
+}
+
+// Apply the staleness policy after a scrape.
+func (e *Exporter) track(err error) {
+	stale := e.stale.Load()
+	now := time.Now()
+
+	if err == nil {
+		e.failures.Store(0)
+		e.updated.Store(now.UnixNano())
+		e.metrics.RecordAge(e.inst, 0, false, stale.Policy)
+
+		return
+	}
+
+	failures := e.failures.Add(1)
+	age := now.Sub(time.Unix(0, e.updated.Load()))
+	e.metrics.RecordAge(e.inst, age, failures >= int64(stale.After), stale.Policy)
+
+	// Only drop once; the series return with the next good scrape.
+	if stale.Policy == StaleDrop && failures == int64(stale.After) {
+		if droppable, ok := e.obj.(IDroppable); ok {
+			droppable.Drop()
+
+			e.lgr.Info(
+				"Dropped stale series.",
+				"exporter", e.name,
+				"failures", failures,
+			)
+		}
+	}
 }
 
-func NewExporter(name string, obj IExporter, lgr logger.ILogger) *Exporter {
-	return &Exporter{
-		name: name,
-		obj:  obj,
-		lgr:  lgr,
+// Scrape and record the outcome.
+func (e *Exporter) run(ctx context.Context) *Result {
+	start := time.Now()
+	err := e.breaker.Allow("")
+	if err == nil {
+		err = targetPanics(e.lgr, e.metrics, e.inst, e.Scrape(ctx))
 	}
+
+	// Nothing was fetched, so there is nothing to record.
+	if errors.Is(err, ErrSkipped) {
+		e.lgr.Debug(
+			"Scrape skipped.",
+			"exporter", e.name,
+			"reason", err.Error(),
+		)
+
+		return &Result{
+			Time:     start,
+			Duration: time.Since(start).Seconds(),
+			Success:  true,
+			Skipped:  true,
+		}
+	}
+
+	// Running out of quota says nothing about the health of the
+	// target, or the freshness of its data, so nothing is recorded
+	// beyond the refusal itself.
+	if Classify(err) == ClassLimit {
+		return &Result{
+			Time:     start,
+			Duration: time.Since(start).Seconds(),
+			Skipped:  true,
+			Class:    ClassLimit,
+			Error:    err.Error(),
+		}
+	}
+
+	// Nor does a refusal by the breaker itself.
+	if Classify(err) != ClassBreaker {
+		e.breaker.Done("", err)
+	}
+
+	e.metrics.Record(e.inst, time.Since(start), err)
+	e.track(err)
+
+	res := NewResult(start, err)
+	e.last.Store(res)
+	e.writeTextfile()
+
+	if logPanic(e.lgr, e.name, err) && e.onPanic != nil {
+		e.onPanic(e, err)
+	}
+
+	return res
+}
+
+// Write the exporter's metrics for the node_exporter textfile collector,
+// along with the health of every instance.
+func (e *Exporter) writeTextfile() {
+	writeTextfile(e.lgr, e.textfile, e.gatherer)
+	writeTextfile(e.lgr, e.healthfile, e.health)
 }
 
-func (e *Exporter) Action(_ **process.State) {
+func (e *Exporter) Action(state **process.State) {
 	e.lgr.Debug(
 		"Refreshing data",
 		"exporter", e.name,
 	)
 
-	_ = e.obj.Scrape()
+	res := e.run((*state).Context())
+
+	switch {
+	case res.Success:
+
+	case res.Class == ClassBreaker, res.Class == ClassLimit:
+		// Already logged when the circuit opened, or accounted
+		// for by the quota's own metrics.
+		e.lgr.Debug(
+			"Scrape refused.",
+			"exporter", e.name,
+			"err", res.Error,
+		)
+
+	default:
+		e.lgr.Warn(
+			"Scrape failed.",
+			"exporter", e.name,
+			"class", res.Class,
+			"err", res.Error,
+		)
+	}
 }
 
 /* exporter.go ends here. */
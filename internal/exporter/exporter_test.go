@@ -0,0 +1,136 @@
+/*
+ * exporter_test.go --- Exporter scrape tests.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRunLimit(t *testing.T) {
+	errLimit := NewError(ClassLimit, errors.New("no calls left"))
+
+	script("limited", func(n int) error {
+		if n == 1 {
+			return nil
+		}
+
+		return errLimit
+	})
+
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inst := &Instance{
+		Type:   "fake",
+		Name:   "limited",
+		Config: json.RawMessage(`{"stale": {"policy": "drop", "after": 1}}`),
+	}
+	e := NewExporter(inst, &fakeExporter{name: "limited"}, metrics, logger.NewDefaultLogger())
+
+	if res := e.run(context.Background()); !res.Success {
+		t.Fatalf("first scrape: %+v, want success", res)
+	}
+
+	res := e.run(context.Background())
+	if !res.Skipped || res.Class != ClassLimit {
+		t.Errorf("refused scrape: %+v, want skipped with class %s", res, ClassLimit)
+	}
+
+	// A refusal is not a failure, so must not count towards staleness.
+	if n := e.failures.Load(); n != 0 {
+		t.Errorf("failures = %d, want 0", n)
+	}
+
+	success := metrics.Success.WithLabelValues("fake", "limited")
+	if val := testutil.ToFloat64(success); val != 1 {
+		t.Errorf("scrape_success = %v, want 1", val)
+	}
+
+	if n := testutil.CollectAndCount(metrics.Errors); n != 0 {
+		t.Errorf("%d error series, want none", n)
+	}
+}
+
+func TestRunTargetPanics(t *testing.T) {
+	script("partial", func(int) error {
+		return TargetPanics([]error{
+			nil,
+			&PanicError{Value: "boom", Target: "h1"},
+			errFailed,
+		})
+	})
+
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inst := &Instance{Type: "fake", Name: "partial"}
+	e := NewExporter(inst, &fakeExporter{name: "partial"}, metrics, logger.NewDefaultLogger())
+
+	restarted := false
+	e.onPanic = func(*Exporter, error) { restarted = true }
+
+	// The other targets were scraped, so the scrape succeeded.
+	if res := e.run(context.Background()); !res.Success {
+		t.Errorf("result = %+v, want success", res)
+	}
+
+	if restarted {
+		t.Error("a target panic restarted the exporter")
+	}
+
+	panics := metrics.Panics.WithLabelValues("fake", "partial")
+	if val := testutil.ToFloat64(panics); val != 1 {
+		t.Errorf("panics_total = %v, want 1", val)
+	}
+}
+
+func TestTargetPanics(t *testing.T) {
+	if err := TargetPanics([]error{nil, errFailed}); err != nil {
+		t.Errorf("got %v without any panics", err)
+	}
+
+	err := TargetPanics([]error{&PanicError{Value: "a"}, errFailed, &PanicError{Value: "b"}})
+	if err == nil || err.Error() != "Panic: a\nPanic: b" {
+		t.Errorf("got %v, want both panics", err)
+	}
+}
+
+/* exporter_test.go ends here. */
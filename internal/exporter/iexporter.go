@@ -29,9 +29,43 @@
 
 package exporter
 
+import (
+	"context"
+)
+
+// Exporters must honour the context given to `Scrape`, which will carry
+// a deadline of `Timeout` seconds and will be cancelled on shutdown.
 type IExporter interface {
 	Interval() int
-	Scrape() error
+	Timeout() int
+	Scrape(context.Context) error
+}
+
+// Exporters that can apply a new configuration in place.
+//
+// This lets counters and other state survive a configuration reload.
+type IReloadable interface {
+	Reload(*Instance) error
+}
+
+// Exporters that hold on to resources, such as registered metrics, that
+// must be released once the exporter is stopped.
+type ICloser interface {
+	Close()
+}
+
+// Return the per-scrape timeout for an exporter.
+//
+// A timeout that is unset or longer than the interval is clamped to
+// the interval so that scrapes cannot pile up behind each other.
+func ScrapeTimeout(obj IExporter) int {
+	timeout := obj.Timeout()
+
+	if timeout <= 0 || timeout > obj.Interval() {
+		timeout = obj.Interval()
+	}
+
+	return timeout
 }
 
 /* iexporter.go ends here. */
@@ -0,0 +1,117 @@
+/*
+ * instance.go --- Named exporter instances.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+var (
+	instanceNameRE = regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+$`)
+)
+
+// A named instance of an exporter type.
+type Instance struct {
+	Type   string          // Exporter type, e.g. "sabnzbd".
+	Name   string          // Instance name, used for the `instance` label.
+	Config json.RawMessage // Configuration section, minus the name.
+}
+
+// Return the process name for the instance.
+//
+// An unnamed instance takes the name of its type, and its process is
+// named after the type alone so that single-instance configurations
+// behave as they always have.
+func (i *Instance) ProcessName() string {
+	if i.Name == i.Type {
+		return i.Type
+	}
+
+	return fmt.Sprintf("%s:%s", i.Type, i.Name)
+}
+
+// Split an exporter's configuration section into instances.
+//
+// The section is either a single object, which yields one instance named
+// after the exporter type, or a list of objects which each carry a unique
+// `name` key.
+func Instances(typ string, section json.RawMessage) ([]*Instance, error) {
+	var list []map[string]json.RawMessage
+
+	if len(section) == 0 || section[0] != '[' {
+		return []*Instance{{Type: typ, Name: typ, Config: section}}, nil
+	}
+
+	if err := json.Unmarshal(section, &list); err != nil {
+		return nil, fmt.Errorf("%s: %s", typ, err.Error())
+	}
+
+	if len(list) > 1 && Single(typ) {
+		return nil, fmt.Errorf("%s[1]: only one instance is allowed", typ)
+	}
+
+	seen := map[string]bool{}
+	insts := []*Instance{}
+	for idx, obj := range list {
+		var name string
+
+		raw, ok := obj["name"]
+		if !ok {
+			return nil, fmt.Errorf("%s[%d]: instance has no name", typ, idx)
+		}
+
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return nil, fmt.Errorf("%s[%d].name: %s", typ, idx, err.Error())
+		}
+
+		if !instanceNameRE.MatchString(name) {
+			return nil, fmt.Errorf("%s[%d].name: invalid name '%s'", typ, idx, name)
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("%s[%d].name: duplicate name '%s'", typ, idx, name)
+		}
+		seen[name] = true
+
+		delete(obj, "name")
+		cnf, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		insts = append(insts, &Instance{Type: typ, Name: name, Config: cnf})
+	}
+
+	return insts, nil
+}
+
+/* instance.go ends here. */
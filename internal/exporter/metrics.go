@@ -0,0 +1,182 @@
+/*
+ * metrics.go --- Exporter health metrics.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"github.com/Asmodai/master-exporter/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"time"
+)
+
+type Metrics struct {
+	Duration    *prometheus.GaugeVec
+	Success     *prometheus.GaugeVec
+	LastSuccess *prometheus.GaugeVec
+	DataAge     *prometheus.GaugeVec
+	Up          *prometheus.GaugeVec
+	Errors      *prometheus.CounterVec
+	Panics      *prometheus.CounterVec
+	Breaker     *prometheus.GaugeVec
+}
+
+// Create the health metrics shared by all exporters.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		Duration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "master_exporter",
+			Name:      "scrape_duration_seconds",
+			Help:      "Duration of the last scrape. Seconds.",
+		}, []string{"exporter", "instance"}),
+
+		Success: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "master_exporter",
+			Name:      "scrape_success",
+			Help:      "Did the last scrape succeed?",
+		}, []string{"exporter", "instance"}),
+
+		LastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "master_exporter",
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Time of the last successful scrape. Seconds since the epoch.",
+		}, []string{"exporter", "instance"}),
+
+		DataAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "master_exporter",
+			Name:      "data_age_seconds",
+			Help:      "Age of the exporter's data as of the last scrape. Seconds.",
+		}, []string{"exporter", "instance"}),
+
+		Up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "master_exporter",
+			Name:      "up",
+			Help:      "Is the exporter's data fresh?  Only set by the 'mark' staleness policy.",
+		}, []string{"exporter", "instance"}),
+
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "master_exporter",
+			Name:      "scrape_errors_total",
+			Help:      "Total number of failed scrapes by error class.",
+		}, []string{"exporter", "instance", "class"}),
+
+		Panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "master_exporter",
+			Name:      "panics_total",
+			Help:      "Total number of panics recovered from.",
+		}, []string{"exporter", "instance"}),
+
+		Breaker: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "master_exporter",
+			Name:      "breaker_state",
+			Help:      breakerHelp,
+		}, []string{"exporter", "instance", "target"}),
+	}
+
+	group := metrics.NewGroup(reg)
+	group.Register(m.Duration)
+	group.Register(m.Success)
+	group.Register(m.LastSuccess)
+	group.Register(m.DataAge)
+	group.Register(m.Up)
+	group.Register(m.Errors)
+	group.Register(m.Panics)
+	group.Register(m.Breaker)
+
+	if err := group.Err(); err != nil {
+		group.UnregisterAll()
+
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Record the outcome of a scrape for the given exporter instance.
+func (m *Metrics) Record(inst *Instance, elapsed time.Duration, err error) {
+	m.Duration.WithLabelValues(inst.Type, inst.Name).Set(elapsed.Seconds())
+
+	if err != nil {
+		m.Success.WithLabelValues(inst.Type, inst.Name).Set(0)
+		m.Errors.WithLabelValues(inst.Type, inst.Name, Classify(err)).Inc()
+
+		if Classify(err) == ClassPanic {
+			m.RecordPanic(inst)
+		}
+
+		return
+	}
+
+	m.Success.WithLabelValues(inst.Type, inst.Name).Set(1)
+	m.LastSuccess.WithLabelValues(inst.Type, inst.Name).SetToCurrentTime()
+}
+
+// Count a recovered panic for the given exporter instance.
+func (m *Metrics) RecordPanic(inst *Instance) {
+	m.Panics.WithLabelValues(inst.Type, inst.Name).Inc()
+}
+
+// Record the staleness of an exporter instance's data.
+//
+// `up` is only reported under the 'mark' policy.
+func (m *Metrics) RecordAge(inst *Instance, age time.Duration, stale bool, policy string) {
+	m.DataAge.WithLabelValues(inst.Type, inst.Name).Set(age.Seconds())
+
+	if policy != StaleMark {
+		m.Up.DeleteLabelValues(inst.Type, inst.Name)
+
+		return
+	}
+
+	if stale {
+		m.Up.WithLabelValues(inst.Type, inst.Name).Set(0)
+	} else {
+		m.Up.WithLabelValues(inst.Type, inst.Name).Set(1)
+	}
+}
+
+// Delete all series for an exporter instance that has been stopped.
+func (m *Metrics) Forget(inst *Instance) {
+	match := prometheus.Labels{
+		"exporter": inst.Type,
+		"instance": inst.Name,
+	}
+
+	m.Duration.DeletePartialMatch(match)
+	m.Success.DeletePartialMatch(match)
+	m.LastSuccess.DeletePartialMatch(match)
+	m.DataAge.DeletePartialMatch(match)
+	m.Up.DeletePartialMatch(match)
+	m.Errors.DeletePartialMatch(match)
+	m.Panics.DeletePartialMatch(match)
+	m.Breaker.DeletePartialMatch(match)
+}
+
+/* metrics.go ends here. */
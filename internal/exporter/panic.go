@@ -0,0 +1,147 @@
+/*
+ * panic.go --- Panic recovery.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"github.com/Asmodai/gohacks/logger"
+
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// A panic raised by a collector, recovered so that it cannot take down
+// the other collectors with it.
+type PanicError struct {
+	Value  interface{}
+	Stack  []byte
+	Target string // The target being scraped, if any.
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("Panic: %v", e.Value) }
+func (e *PanicError) Class() string { return ClassPanic }
+
+// Panics in some of an exporter's targets.
+//
+// The other targets were scraped regardless, so the scrape still counts
+// as a success, but the panics are logged and counted all the same.
+type TargetPanicError struct {
+	Panics []error
+}
+
+func (e *TargetPanicError) Error() string   { return errors.Join(e.Panics...).Error() }
+func (e *TargetPanicError) Unwrap() []error { return e.Panics }
+
+// Gather the panics among the errors from `EachTarget`.
+//
+// Returns nil if there were none.
+func TargetPanics(errs []error) error {
+	panics := []error{}
+
+	for _, err := range errs {
+		var pe *PanicError
+
+		if errors.As(err, &pe) {
+			panics = append(panics, pe)
+		}
+	}
+
+	if len(panics) == 0 {
+		return nil
+	}
+
+	return &TargetPanicError{Panics: panics}
+}
+
+// Scrape, turning a panic into a `PanicError`.
+func safeScrape(ctx context.Context, obj IExporter) (err error) {
+	defer func() {
+		if val := recover(); val != nil {
+			err = &PanicError{
+				Value: val,
+				Stack: debug.Stack(),
+			}
+		}
+	}()
+
+	return obj.Scrape(ctx)
+}
+
+// Log the stack trace of a panic, should the error be one.
+func logPanic(lgr logger.ILogger, name string, err error) bool {
+	var pe *PanicError
+
+	if !errors.As(err, &pe) {
+		return false
+	}
+
+	if pe.Target != "" {
+		lgr.Error(
+			"Exporter panicked.",
+			"exporter", name,
+			"target", pe.Target,
+			"panic", fmt.Sprintf("%v", pe.Value),
+			"stack", string(pe.Stack),
+		)
+
+		return true
+	}
+
+	lgr.Error(
+		"Exporter panicked.",
+		"exporter", name,
+		"panic", fmt.Sprintf("%v", pe.Value),
+		"stack", string(pe.Stack),
+	)
+
+	return true
+}
+
+// Log and count the panics of individual targets.
+//
+// These leave the scrape a success, so nil is returned in their place.
+// Any other error is returned as it is.
+func targetPanics(lgr logger.ILogger, mtx *Metrics, inst *Instance, err error) error {
+	var tpe *TargetPanicError
+
+	if !errors.As(err, &tpe) {
+		return err
+	}
+
+	for _, pe := range tpe.Panics {
+		logPanic(lgr, inst.ProcessName(), pe)
+		mtx.RecordPanic(inst)
+	}
+
+	return nil
+}
+
+/* panic.go ends here. */
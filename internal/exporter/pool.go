@@ -0,0 +1,698 @@
+/*
+ * pool.go --- Running exporter instances.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"github.com/Asmodai/gohacks/logger"
+	"github.com/Asmodai/gohacks/process"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StateRetrying = "retrying" // Waiting on a successful initial scrape.
+	StateRunning  = "running"  // Scraping periodically.
+	StatePaused   = "paused"   // Periodic scraping suspended.
+)
+
+var (
+	retryMin time.Duration = time.Second
+	retryMax time.Duration = time.Minute * 5
+)
+
+type member struct {
+	inst   *Instance
+	reg    *prometheus.Registry
+	obj    IExporter
+	exp    *Exporter
+	proc   *process.Process
+	state  string
+	err    error
+	last   *Result
+	cancel context.CancelFunc
+
+	// Restarts after a panic, and when the last one happened.
+	restarts  int
+	restarted time.Time
+}
+
+// Summary of what `Apply` changed.
+type Changes struct {
+	Started  []string `json:"started"`
+	Retrying []string `json:"retrying"`
+	Stopped  []string `json:"stopped"`
+	Reloaded []string `json:"reloaded"`
+}
+
+func NewChanges() *Changes {
+	return &Changes{
+		Started:  []string{},
+		Retrying: []string{},
+		Stopped:  []string{},
+		Reloaded: []string{},
+	}
+}
+
+// The set of exporter instances that are currently running.
+//
+// The pool is used both at startup and on configuration reload, where
+// the new configuration is compared against what is running so that
+// only instances which have changed are touched.
+type Pool struct {
+	sync.Mutex
+
+	deps     *Deps
+	mgr      process.IManager
+	lgr      logger.ILogger
+	metrics  *Metrics
+	members  map[string]*member
+	textfile string
+	health   prometheus.Gatherer
+}
+
+// Create a new pool, registering the exporter health metrics with the
+// registerer in `deps`.
+func NewPool(deps *Deps, mgr process.IManager, lgr logger.ILogger) (*Pool, error) {
+	metrics, err := NewMetrics(deps.Registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pool{
+		deps:    deps,
+		mgr:     mgr,
+		lgr:     lgr,
+		metrics: metrics,
+		members: map[string]*member{},
+	}, nil
+}
+
+// Write each instance's metrics to a file in the given directory after
+// every scrape, for the node_exporter textfile collector.
+//
+// The health of every instance goes to a file of its own, along with
+// whatever else `health` gathers, such as our own metrics.  Only
+// instances started afterwards are affected.
+func (p *Pool) SetTextfile(dir string, health prometheus.Gatherer) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.textfile = dir
+	p.health = health
+}
+
+// Return the textfile for the health metrics, or "" if there is none.
+func (p *Pool) healthfile() string {
+	if p.textfile == "" || p.health == nil {
+		return ""
+	}
+
+	return filepath.Join(p.textfile, healthFile)
+}
+
+// Write the health metrics out now, such as after a reload.
+func (p *Pool) WriteTextfile() {
+	p.Lock()
+	file, health := p.healthfile(), p.health
+	p.Unlock()
+
+	writeTextfile(p.lgr, file, health)
+}
+
+// Return the textfile for an instance, or "" if there is none.
+func (p *Pool) textfileFor(inst *Instance) string {
+	if p.textfile == "" {
+		return ""
+	}
+
+	name := strings.ReplaceAll(inst.ProcessName(), ":", "_")
+
+	return filepath.Join(p.textfile, name+".prom")
+}
+
+// Gather the metrics of every instance.
+//
+// Each instance has a registry of its own, so that its metrics can be
+// written out separately.
+func (p *Pool) Gather() ([]*dto.MetricFamily, error) {
+	p.Lock()
+	gatherers := prometheus.Gatherers{}
+	for _, m := range p.members {
+		gatherers = append(gatherers, m.reg)
+	}
+	p.Unlock()
+
+	return gatherers.Gather()
+}
+
+// Return the process names of all running instances.
+func (p *Pool) Names() []string {
+	p.Lock()
+	defer p.Unlock()
+
+	names := []string{}
+	for k := range p.members {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Return the process names of instances still waiting on a successful
+// initial scrape, along with the error from their last attempt.
+func (p *Pool) Pending() map[string]error {
+	p.Lock()
+	defer p.Unlock()
+
+	pending := map[string]error{}
+	for k, m := range p.members {
+		if m.state == StateRetrying {
+			pending[k] = m.err
+		}
+	}
+
+	return pending
+}
+
+// Return the status of every instance, whether running, paused or still
+// retrying its initial scrape.
+func (p *Pool) Status() []*Status {
+	p.Lock()
+	defer p.Unlock()
+
+	status := []*Status{}
+
+	for _, m := range p.members {
+		st := m.status()
+
+		// `Running` is not safe to read, but a stopped process will
+		// always have had its context cancelled.
+		if m.proc != nil && m.proc.Context().Err() != nil {
+			st.State = StateStopped
+		}
+
+		status = append(status, st)
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+
+	return status
+}
+
+// Bring the running instances in line with the given configuration.
+//
+// `enabled` lists the exporter types to run, and `sections` holds the
+// configuration section for each type.  Instances that are no longer
+// wanted are stopped, new ones are started, and those whose section has
+// changed are reloaded.
+//
+// Errors are collected rather than aborting, so one bad section does not
+// prevent the rest of the configuration from being applied.
+func (p *Pool) Apply(enabled []string, sections map[string]json.RawMessage) (*Changes, error) {
+	var errs []error
+
+	changes := NewChanges()
+	wanted := map[string]*Instance{}
+
+	for _, typ := range enabled {
+		insts, err := Instances(typ, sections[typ])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, inst := range insts {
+			wanted[inst.ProcessName()] = inst
+		}
+	}
+
+	p.Lock()
+
+	for name := range p.members {
+		if _, ok := wanted[name]; !ok {
+			p.stop(name)
+			changes.Stopped = append(changes.Stopped, name)
+		}
+	}
+
+	names := []string{}
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	started := []*member{}
+	restarted := []*member{}
+	for _, name := range names {
+		inst := wanted[name]
+
+		m, ok := p.members[name]
+		if !ok {
+			fresh, err := p.start(inst)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			started = append(started, fresh)
+
+			continue
+		}
+
+		if bytes.Equal(m.inst.Config, inst.Config) {
+			continue
+		}
+
+		fresh, err := p.reload(m, inst)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if fresh != nil {
+			restarted = append(restarted, fresh)
+		}
+
+		changes.Reloaded = append(changes.Reloaded, name)
+	}
+
+	p.Unlock()
+
+	// Initial scrapes can take a while, so are done all at once and
+	// without the pool locked.
+	running := p.firstAll(append(started, restarted...))
+	for idx, m := range started {
+		if running[idx] {
+			changes.Started = append(changes.Started, m.inst.ProcessName())
+		} else {
+			changes.Retrying = append(changes.Retrying, m.inst.ProcessName())
+		}
+	}
+
+	return changes, errors.Join(errs...)
+}
+
+// Stop all running instances.
+func (p *Pool) StopAll() {
+	p.Lock()
+	defer p.Unlock()
+
+	for name := range p.members {
+		p.stop(name)
+	}
+
+	removeTextfile(p.lgr, p.healthfile())
+}
+
+// Create an instance, ready for its initial scrape.
+//
+// The instance is left retrying until `first` has been called.
+func (p *Pool) start(inst *Instance) (*member, error) {
+	if _, err := ParseStaleness(inst); err != nil {
+		return nil, err
+	}
+
+	if _, err := ParseBreaker(inst); err != nil {
+		return nil, err
+	}
+
+	deps := *p.deps
+	reg := prometheus.NewRegistry()
+	deps.Registerer = reg
+
+	obj, err := Create(&deps, inst)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &member{
+		inst:  inst,
+		reg:   reg,
+		obj:   obj,
+		state: StateRetrying,
+	}
+	p.members[inst.ProcessName()] = m
+
+	return m, nil
+}
+
+// Try a new instance's initial scrape.
+//
+// Should the scrape fail, the instance is left retrying in the
+// background so that one unavailable service does not hold up the
+// others.  This must be called without the pool locked.
+//
+// Returns whether the instance is running.
+func (p *Pool) first(m *member) bool {
+	res, err := p.initial(p.deps.Context, m)
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.members[m.inst.ProcessName()] != m || m.state != StateRetrying {
+		// Stopped or started while we were scraping.
+		return m.state == StateRunning
+	}
+
+	m.last = res
+
+	if err != nil {
+		m.err = err
+
+		p.lgr.Warn(
+			"Initial scrape failed, will retry.",
+			"exporter", m.inst.Type,
+			"instance", m.inst.Name,
+			"err", err.Error(),
+		)
+
+		ctx, cancel := context.WithCancel(p.deps.Context)
+		m.cancel = cancel
+		go p.retry(ctx, m, retryMin)
+
+		return false
+	}
+
+	p.run(m)
+
+	return true
+}
+
+// Try the initial scrapes of several instances in parallel.
+//
+// Returns whether each instance is running.
+func (p *Pool) firstAll(members []*member) []bool {
+	running := make([]bool, len(members))
+	wg := sync.WaitGroup{}
+
+	for idx := range members {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+
+			running[idx] = p.first(members[idx])
+		}(idx)
+	}
+	wg.Wait()
+
+	return running
+}
+
+// Perform an initial scrape, recording the result in the metrics.
+func (p *Pool) initial(ctx context.Context, m *member) (*Result, error) {
+	start := time.Now()
+	err := targetPanics(p.lgr, p.metrics, m.inst, ScrapeNow(ctx, m.obj))
+	p.metrics.Record(m.inst, time.Since(start), err)
+	logPanic(p.lgr, m.inst.ProcessName(), err)
+
+	return NewResult(start, err), err
+}
+
+// Retry the initial scrape with exponential backoff, starting with the
+// given delay, until it succeeds or the member is stopped.
+func (p *Pool) retry(ctx context.Context, m *member, delay time.Duration) {
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-time.After(delay):
+		}
+
+		res, err := p.initial(ctx, m)
+
+		p.Lock()
+		if ctx.Err() != nil {
+			// Stopped while we were scraping.
+			p.Unlock()
+
+			return
+		}
+
+		if m.state != StateRetrying {
+			// Started by someone else in the meantime.
+			p.Unlock()
+
+			return
+		}
+
+		m.last = res
+
+		if err == nil {
+			p.run(m)
+			p.Unlock()
+
+			return
+		}
+
+		m.err = err
+		p.Unlock()
+
+		if delay *= 2; delay > retryMax {
+			delay = retryMax
+		}
+
+		p.lgr.Warn(
+			"Initial scrape failed, will retry.",
+			"exporter", m.inst.Type,
+			"instance", m.inst.Name,
+			"retry", delay.String(),
+			"err", err.Error(),
+		)
+	}
+}
+
+// Start the periodic process for a member.
+func (p *Pool) run(m *member) {
+	p.lgr.Info(
+		"Initial scrape complete.",
+		"exporter", m.inst.Type,
+		"instance", m.inst.Name,
+	)
+
+	params := NewParams(m.inst, m.obj, p.metrics, p.mgr, p.lgr)
+	params.gatherer = m.reg
+	params.textfile = p.textfileFor(m.inst)
+	params.health = p.health
+	params.healthfile = p.healthfile()
+	params.onPanic = func(exp *Exporter, err error) {
+		// The exporter's own process is stopped by the restart,
+		// so this cannot wait for it.
+		go p.restart(m, exp, err)
+	}
+
+	m.exp, m.proc = spawn(params)
+	m.exp.last.Store(m.last)
+	m.exp.writeTextfile()
+	m.state = StateRunning
+	m.err = nil
+
+	// Whoever started it, any retries are no longer wanted.
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+}
+
+// Restart a member whose exporter panicked.
+//
+// The exporter is replaced by a fresh one, which then has to manage a
+// successful initial scrape before running again, just like a new one.
+// Panics in quick succession lengthen the wait before the first attempt.
+func (p *Pool) restart(m *member, exp *Exporter, err error) {
+	p.Lock()
+	defer p.Unlock()
+
+	name := m.inst.ProcessName()
+	if p.members[name] != m || m.exp != exp || m.state != StateRunning {
+		// Stopped, paused or restarted in the meantime.
+		return
+	}
+
+	deps := *p.deps
+	reg := prometheus.NewRegistry()
+	deps.Registerer = reg
+
+	// Release the old exporter's resources before creating its
+	// replacement, as they may well clash.
+	m.halt()
+	if closer, ok := m.obj.(ICloser); ok {
+		closer.Close()
+	}
+
+	obj, cerr := Create(&deps, m.inst)
+	if cerr != nil {
+		p.lgr.Error(
+			"Could not restart exporter.",
+			"exporter", m.inst.Type,
+			"instance", m.inst.Name,
+			"err", cerr.Error(),
+		)
+
+		m.obj = nil
+		p.stop(name)
+
+		return
+	}
+
+	if time.Since(m.restarted) > retryMax {
+		m.restarts = 0
+	}
+	m.restarts++
+	m.restarted = time.Now()
+
+	delay := retryMin
+	for i := 1; i < m.restarts && delay < retryMax; i++ {
+		delay *= 2
+	}
+
+	if delay > retryMax {
+		delay = retryMax
+	}
+
+	ctx, cancel := context.WithCancel(p.deps.Context)
+
+	m.reg = reg
+	m.obj = obj
+	m.exp = nil
+	m.proc = nil
+	m.state = StateRetrying
+	m.err = err
+	m.last = exp.last.Load()
+	m.cancel = cancel
+
+	p.lgr.Warn(
+		"Exporter restarting after panic.",
+		"exporter", m.inst.Type,
+		"instance", m.inst.Name,
+		"restarts", m.restarts,
+		"retry", delay.String(),
+	)
+
+	go p.retry(ctx, m, delay)
+}
+
+func (p *Pool) stop(name string) {
+	m, ok := p.members[name]
+	if !ok {
+		return
+	}
+
+	if m.cancel != nil {
+		m.cancel()
+	}
+
+	m.halt()
+
+	if closer, ok := m.obj.(ICloser); ok {
+		closer.Close()
+	}
+
+	delete(p.members, name)
+	p.metrics.Forget(m.inst)
+
+	// Left behind, the file would be served as current forever.
+	removeTextfile(p.lgr, p.textfileFor(m.inst))
+
+	p.lgr.Info(
+		"Exporter stopped.",
+		"exporter", m.inst.Type,
+		"instance", m.inst.Name,
+	)
+}
+
+// Apply a new configuration to a member.
+//
+// Returns the member that replaced it, if it had to be started afresh,
+// which then needs its initial scrape.
+func (p *Pool) reload(m *member, inst *Instance) (*member, error) {
+	reloadable, ok := m.obj.(IReloadable)
+	if !ok || m.state == StateRetrying {
+		// Nothing else for it but to start afresh, which also gives a
+		// retrying instance a fresh attempt with its new configuration.
+		p.stop(m.inst.ProcessName())
+
+		return p.start(inst)
+	}
+
+	stale, err := ParseStaleness(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	breaker, err := ParseBreaker(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := m.exp.Interval()
+	if err := reloadable.Reload(inst); err != nil {
+		return nil, validate.Qualify(inst.ProcessName(), err)
+	}
+
+	// Any interval set at runtime gives way to the configuration.
+	m.inst = inst
+	m.exp.setInterval(0)
+	m.exp.stale.Store(stale)
+	m.exp.breaker.SetConfig(breaker)
+
+	// A process's interval is fixed once it is running.
+	if m.state == StateRunning && m.exp.Interval() != interval {
+		m.halt()
+		m.proc = respawn(p.mgr, m.exp)
+	}
+
+	p.lgr.Info(
+		"Exporter reloaded.",
+		"exporter", inst.Type,
+		"instance", inst.Name,
+	)
+
+	return nil, nil
+}
+
+/* pool.go ends here. */
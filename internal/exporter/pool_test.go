@@ -0,0 +1,410 @@
+/*
+ * pool_test.go --- Exporter pool tests.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"github.com/Asmodai/gohacks/logger"
+	"github.com/Asmodai/gohacks/process"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// How each fake instance's scrapes go, keyed by instance name.  `n`
+// counts the instance's scrapes from 1.
+var (
+	scriptMu sync.Mutex
+	scripts  = map[string]func(n int) error{}
+)
+
+func script(name string, fn func(n int) error) {
+	scriptMu.Lock()
+	defer scriptMu.Unlock()
+
+	scripts[name] = fn
+}
+
+type fakeExporter struct {
+	name    string
+	calls   atomic.Int32
+	reloads atomic.Int32
+}
+
+func (f *fakeExporter) Interval() int { return 60 }
+func (f *fakeExporter) Timeout() int  { return 5 }
+
+func (f *fakeExporter) Scrape(context.Context) error {
+	n := f.calls.Add(1)
+
+	scriptMu.Lock()
+	fn := scripts[f.name]
+	scriptMu.Unlock()
+
+	if fn == nil {
+		return nil
+	}
+
+	return fn(int(n))
+}
+
+func (f *fakeExporter) Reload(*Instance) error {
+	f.reloads.Add(1)
+
+	return nil
+}
+
+func init() {
+	Register("fake", func(_ *Deps, inst *Instance) (IExporter, error) {
+		var cnf struct {
+			Bad bool `json:"bad"`
+		}
+
+		if len(inst.Config) > 0 {
+			if err := json.Unmarshal(inst.Config, &cnf); err != nil {
+				return nil, err
+			}
+		}
+
+		if cnf.Bad {
+			return nil, errors.New("bad configuration")
+		}
+
+		return &fakeExporter{name: inst.Name}, nil
+	})
+}
+
+func newTestPool(t *testing.T) *Pool {
+	t.Helper()
+
+	return newTestPoolWith(t, prometheus.NewRegistry())
+}
+
+// Create a pool whose health metrics are registered with `reg`.
+func newTestPoolWith(t *testing.T, reg prometheus.Registerer) *Pool {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lgr := logger.NewDefaultLogger()
+	deps := &Deps{
+		Context:    ctx,
+		Logger:     lgr,
+		Registerer: reg,
+	}
+
+	pool, err := NewPool(deps, process.NewManagerWithContext(ctx), lgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		pool.StopAll()
+		cancel()
+	})
+
+	return pool
+}
+
+func fakes(section string) map[string]json.RawMessage {
+	return map[string]json.RawMessage{"fake": json.RawMessage(section)}
+}
+
+func TestPoolApply(t *testing.T) {
+	script("down", func(int) error { return errFailed })
+
+	pool := newTestPool(t)
+
+	steps := []struct {
+		name    string
+		enabled []string
+		section string
+		want    *Changes
+		err     bool
+		running []string
+	}{
+		{
+			name:    "start",
+			enabled: []string{"fake"},
+			section: `[{"name":"up"},{"name":"down"}]`,
+			want: &Changes{
+				Started:  []string{"fake:up"},
+				Retrying: []string{"fake:down"},
+				Stopped:  []string{},
+				Reloaded: []string{},
+			},
+			running: []string{"fake:down", "fake:up"},
+		},
+		{
+			name:    "unchanged",
+			enabled: []string{"fake"},
+			section: `[{"name":"up"},{"name":"down"}]`,
+			want:    NewChanges(),
+			running: []string{"fake:down", "fake:up"},
+		},
+		{
+			name:    "reload and stop",
+			enabled: []string{"fake"},
+			section: `[{"name":"up","x":1}]`,
+			want: &Changes{
+				Started:  []string{},
+				Retrying: []string{},
+				Stopped:  []string{"fake:down"},
+				Reloaded: []string{"fake:up"},
+			},
+			running: []string{"fake:up"},
+		},
+		{
+			name:    "bad instance",
+			enabled: []string{"fake"},
+			section: `[{"name":"up","x":1},{"name":"bad","bad":true}]`,
+			want:    NewChanges(),
+			err:     true,
+			running: []string{"fake:up"},
+		},
+		{
+			name:    "disabled",
+			enabled: []string{},
+			want: &Changes{
+				Started:  []string{},
+				Retrying: []string{},
+				Stopped:  []string{"fake:up"},
+				Reloaded: []string{},
+			},
+			running: []string{},
+		},
+	}
+
+	for _, step := range steps {
+		changes, err := pool.Apply(step.enabled, fakes(step.section))
+		if (err != nil) != step.err {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+
+		if !reflect.DeepEqual(changes, step.want) {
+			t.Errorf("%s: changes = %+v, want %+v", step.name, changes, step.want)
+		}
+
+		if names := pool.Names(); !reflect.DeepEqual(names, step.running) {
+			t.Errorf("%s: names = %v, want %v", step.name, names, step.running)
+		}
+	}
+}
+
+func TestPoolReloadInPlace(t *testing.T) {
+	pool := newTestPool(t)
+
+	if _, err := pool.Apply([]string{"fake"}, fakes(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Lock()
+	before := pool.members["fake"]
+	pool.Unlock()
+
+	if _, err := pool.Apply([]string{"fake"}, fakes(`{"x":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Lock()
+	after := pool.members["fake"]
+	state := after.state
+	pool.Unlock()
+
+	if after != before {
+		t.Error("exporter was restarted rather than reloaded")
+	}
+
+	if n := after.obj.(*fakeExporter).reloads.Load(); n != 1 {
+		t.Errorf("reloads = %d, want 1", n)
+	}
+
+	if state != StateRunning {
+		t.Errorf("state = %s, want %s", state, StateRunning)
+	}
+}
+
+func TestPoolTrigger(t *testing.T) {
+	t.Run("unknown", func(t *testing.T) {
+		pool := newTestPool(t)
+
+		if _, err := pool.Trigger("fake:none"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("err = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("while retrying", func(t *testing.T) {
+		script("late", func(n int) error {
+			if n == 1 {
+				return errFailed
+			}
+
+			return nil
+		})
+
+		pool := newTestPool(t)
+
+		changes, err := pool.Apply([]string{"fake"}, fakes(`[{"name":"late"}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(changes.Retrying) != 1 {
+			t.Fatalf("changes = %+v, want fake:late retrying", changes)
+		}
+
+		res, err := pool.Trigger("fake:late")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !res.Success {
+			t.Errorf("result = %+v, want success", res)
+		}
+
+		pool.Lock()
+		m := pool.members["fake:late"]
+		state, cancel := m.state, m.cancel
+		pool.Unlock()
+
+		if state != StateRunning {
+			t.Errorf("state = %s, want %s", state, StateRunning)
+		}
+
+		if cancel != nil {
+			t.Error("retries were not cancelled")
+		}
+	})
+
+	t.Run("during initial scrape", func(t *testing.T) {
+		entered := make(chan struct{})
+		release := make(chan struct{})
+
+		script("slow", func(n int) error {
+			if n == 1 {
+				close(entered)
+				<-release
+
+				return errFailed
+			}
+
+			return nil
+		})
+
+		pool := newTestPool(t)
+
+		done := make(chan *Changes)
+		go func() {
+			changes, _ := pool.Apply([]string{"fake"}, fakes(`[{"name":"slow"}]`))
+			done <- changes
+		}()
+
+		<-entered
+
+		res, err := pool.Trigger("fake:slow")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !res.Success {
+			t.Errorf("result = %+v, want success", res)
+		}
+
+		close(release)
+
+		// The late failure must not undo the trigger's success.
+		changes := <-done
+		if !reflect.DeepEqual(changes.Started, []string{"fake:slow"}) {
+			t.Errorf("changes = %+v, want fake:slow started", changes)
+		}
+
+		st, err := pool.StatusOf("fake:slow")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if st.State != StateRunning {
+			t.Errorf("state = %s, want %s", st.State, StateRunning)
+		}
+	})
+}
+
+func TestPoolTextfile(t *testing.T) {
+	dir := t.TempDir()
+	health := prometheus.NewRegistry()
+
+	pool := newTestPoolWith(t, health)
+	pool.SetTextfile(dir, health)
+
+	if _, err := pool.Apply([]string{"fake"}, fakes(`[{"name":"a"},{"name":"b"}]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, healthFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Whichever instance wrote it last, both have been scraped.
+	for _, want := range []string{
+		`master_exporter_scrape_success{exporter="fake",instance="a"} 1`,
+		`master_exporter_scrape_success{exporter="fake",instance="b"} 1`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("health textfile lacks %s", want)
+		}
+	}
+
+	for _, name := range []string{"fake_a.prom", "fake_b.prom"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	pool.StopAll()
+
+	left, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(left) != 0 {
+		t.Errorf("%d textfiles left behind after stopping", len(left))
+	}
+}
+
+/* pool_test.go ends here. */
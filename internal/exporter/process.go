@@ -32,20 +32,37 @@ package exporter
 import (
 	"github.com/Asmodai/gohacks/logger"
 	"github.com/Asmodai/gohacks/process"
-	//"github.com/Asmodai/gohacks/types"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Params struct {
 	name string
+	inst *Instance
 	obj  IExporter
+	mtx  *Metrics
 	mgr  process.IManager
 	lgr  logger.ILogger
+
+	// Where to write the exporter's metrics after each scrape, if
+	// anywhere.
+	gatherer prometheus.Gatherer
+	textfile string
+
+	// Where to write the health of every instance, if anywhere.
+	health     prometheus.Gatherer
+	healthfile string
+
+	// What to do should the exporter panic.
+	onPanic func(*Exporter, error)
 }
 
-func NewParams(name string, obj IExporter, mgr process.IManager, lgr logger.ILogger) *Params {
+func NewParams(inst *Instance, obj IExporter, mtx *Metrics, mgr process.IManager, lgr logger.ILogger) *Params {
 	return &Params{
-		name: name,
+		name: inst.ProcessName(),
+		inst: inst,
 		obj:  obj,
+		mtx:  mtx,
 		mgr:  mgr,
 		lgr:  lgr,
 	}
@@ -57,21 +74,63 @@ func Spawn(params *Params) (*process.Process, error) {
 		return inst, nil
 	}
 
+	_, pr := spawn(params)
+
+	return pr, nil
+}
+
+func spawn(params *Params) (*Exporter, *process.Process) {
+	if timeout := ScrapeTimeout(params.obj); timeout != params.obj.Timeout() {
+		params.lgr.Warn(
+			"Scrape timeout clamped to interval.",
+			"exporter", params.name,
+			"timeout", params.obj.Timeout(),
+			"interval", params.obj.Interval(),
+		)
+	}
+
 	e := NewExporter(
-		params.name,
+		params.inst,
 		params.obj,
+		params.mtx,
 		params.lgr,
 	)
+	e.gatherer = params.gatherer
+	e.textfile = params.textfile
+	e.health = params.health
+	e.healthfile = params.healthfile
+	e.onPanic = params.onPanic
 
-	pr := params.mgr.Create(&process.Config{
-		Name:     params.name,
-		Interval: params.obj.Interval(),
+	return e, respawn(params.mgr, e)
+}
+
+// Create and run a new process for an existing exporter.
+//
+// The process takes its context from the process manager, so that it is
+// cancelled on shutdown, but is not added to it.  The manager's list of
+// processes is not safe to change while it is in use, and it has no way
+// of forgetting a process, so the pool keeps track of its own.
+//
+// This waits for the process to start, as a process that is stopped
+// before it has started would otherwise carry on running regardless.
+func respawn(mgr process.IManager, e *Exporter) *process.Process {
+	started := make(chan struct{})
+
+	pr := process.NewProcessWithContext(&process.Config{
+		Name:     e.name,
+		Interval: e.Interval(),
 		Function: e.Action,
-	})
+		OnQuery:  e.query,
+		OnStart: func(**process.State) {
+			close(started)
+		},
+	}, mgr.Context())
+	pr.SetLogger(e.lgr)
 
 	go pr.Run()
+	<-started
 
-	return pr, nil
+	return pr
 }
 
 /* process.go ends here. */
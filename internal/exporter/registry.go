@@ -0,0 +1,231 @@
+/*
+ * registry.go --- Exporter factory registry.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"github.com/Asmodai/master-exporter/internal/state"
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"github.com/Asmodai/gohacks/apiclient"
+	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Dependencies handed to exporter factories.
+//
+// By the time a factory sees it, `Registerer` has been wrapped so that
+// everything registered with it carries the instance's name as a label.
+type Deps struct {
+	Context    context.Context
+	Logger     logger.ILogger
+	Client     apiclient.IApiClient
+	Registerer prometheus.Registerer
+	State      *state.Store
+}
+
+// Return a copy of the dependencies for the given instance.
+func (d *Deps) forInstance(inst *Instance) *Deps {
+	reg := d.Registerer
+	if reg == nil {
+		// Nowhere to export to, but the metrics still work.
+		reg = prometheus.NewRegistry()
+	}
+
+	return &Deps{
+		Context: d.Context,
+		Logger:  d.Logger,
+		Client:  d.Client,
+		State:   d.State,
+		Registerer: prometheus.WrapRegistererWith(
+			prometheus.Labels{"instance": inst.Name},
+			reg,
+		),
+	}
+}
+
+// Build an exporter instance from its configuration section.
+//
+// The instance's section is the raw JSON found under the exporter's name
+// in the configuration file, and will be empty if there was none.
+type FactoryFn func(*Deps, *Instance) (IExporter, error)
+
+// Check an instance's configuration without creating it.
+type CheckFn func(*Instance) error
+
+var (
+	factoryMu sync.RWMutex
+	factories map[string]FactoryFn = map[string]FactoryFn{}
+	checks    map[string]CheckFn   = map[string]CheckFn{}
+	singles   map[string]bool      = map[string]bool{}
+
+	// Keys handled by the pool rather than by the exporter itself.
+	commonKeys []string = []string{"stale", "breaker"}
+)
+
+// Register an exporter factory under the given name.
+//
+// This is intended to be called from an `init` function, and will panic
+// if the name is already taken.
+func Register(name string, fn FactoryFn) {
+	factoryMu.Lock()
+	defer factoryMu.Unlock()
+
+	if fn == nil {
+		panic("exporter: Register factory is nil for " + name)
+	}
+
+	if _, dup := factories[name]; dup {
+		panic("exporter: Register called twice for " + name)
+	}
+
+	factories[name] = fn
+}
+
+// Register a configuration check under the given name.
+//
+// This is intended to be called from an `init` function alongside
+// `Register`.
+func RegisterCheck(name string, fn CheckFn) {
+	factoryMu.Lock()
+	defer factoryMu.Unlock()
+
+	if fn == nil {
+		panic("exporter: RegisterCheck check is nil for " + name)
+	}
+
+	checks[name] = fn
+}
+
+// Allow no more than one instance of the named exporter.
+//
+// This is for exporters bound to a fixed resource, such as a well-known
+// port, which two instances cannot share.
+func RegisterSingle(name string) {
+	factoryMu.Lock()
+	defer factoryMu.Unlock()
+
+	singles[name] = true
+}
+
+// Is the named exporter limited to a single instance?
+func Single(name string) bool {
+	factoryMu.RLock()
+	defer factoryMu.RUnlock()
+
+	return singles[name]
+}
+
+// Is there a factory registered under the given name?
+func Registered(name string) bool {
+	factoryMu.RLock()
+	defer factoryMu.RUnlock()
+
+	_, ok := factories[name]
+
+	return ok
+}
+
+// Return the names of all registered factories.
+func Names() []string {
+	factoryMu.RLock()
+	defer factoryMu.RUnlock()
+
+	names := []string{}
+	for k := range factories {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Create a new exporter instance using the factory for its type.
+func Create(deps *Deps, inst *Instance) (IExporter, error) {
+	factoryMu.RLock()
+	fn, ok := factories[inst.Type]
+	factoryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown exporter '%s'", inst.Type)
+	}
+
+	obj, err := fn(deps.forInstance(inst), inst)
+	if err != nil {
+		return nil, validate.Qualify(inst.ProcessName(), err)
+	}
+
+	return obj, nil
+}
+
+// Check an instance's configuration.
+//
+// Errors are qualified with the instance's process name.
+func Check(inst *Instance) error {
+	factoryMu.RLock()
+	fn, ok := checks[inst.Type]
+	factoryMu.RUnlock()
+
+	errs := []error{}
+	if _, err := ParseStaleness(inst); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := ParseBreaker(inst); err != nil {
+		errs = append(errs, err)
+	}
+
+	if ok {
+		errs = append(errs, validate.Qualify(inst.ProcessName(), fn(inst)))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Decode an exporter's configuration section into the given config.
+//
+// An empty section leaves the config untouched, so defaults apply.  Keys
+// that are neither fields of the config nor common to all exporters are
+// errors.
+func Decode(section json.RawMessage, cnf interface{}) error {
+	if len(section) == 0 {
+		return nil
+	}
+
+	return validate.Decode(section, cnf, commonKeys...)
+}
+
+/* registry.go ends here. */
@@ -0,0 +1,165 @@
+/*
+ * stale.go --- Stale data handling.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	StaleKeep = "keep" // Leave the last values in place.
+	StaleMark = "mark" // Leave the values, but set `up` to 0.
+	StaleDrop = "drop" // Delete the exporter's series.
+)
+
+// What to do with an exporter's series once its data has gone stale.
+//
+// Data is stale once `After` scrapes in a row have failed.
+type Staleness struct {
+	Policy string `json:"policy"`
+	After  int    `json:"after"`
+}
+
+func NewDefaultStaleness() *Staleness {
+	return &Staleness{
+		Policy: StaleMark,
+		After:  1,
+	}
+}
+
+// Exporters that can delete their series when the data goes stale.
+//
+// The series are expected to reappear after the next successful scrape.
+type IDroppable interface {
+	Drop()
+}
+
+// The staleness of each of an exporter's own targets, such as hosts.
+//
+// This lets an exporter apply its staleness policy to each target on its
+// own, as one failing target does not fail the scrape.  Callers are
+// expected to provide their own locking.
+type TargetStaleness struct {
+	cnf      *Staleness
+	failures map[string]int
+}
+
+func NewTargetStaleness(cnf *Staleness) *TargetStaleness {
+	return &TargetStaleness{
+		cnf:      cnf,
+		failures: map[string]int{},
+	}
+}
+
+// Apply new settings, keeping the failures counted so far.
+func (s *TargetStaleness) SetConfig(cnf *Staleness) {
+	s.cnf = cnf
+}
+
+// Record the outcome of a target's scrape.
+//
+// Returns whether the target's data is now stale, and whether its series
+// should be dropped.
+func (s *TargetStaleness) Track(target string, err error) (bool, bool) {
+	if err == nil {
+		delete(s.failures, target)
+
+		return false, false
+	}
+
+	s.failures[target]++
+	stale := s.failures[target] >= s.cnf.After
+
+	return stale, stale && s.cnf.Policy == StaleDrop
+}
+
+// Forget targets not in the given list.
+func (s *TargetStaleness) Retain(targets []string) {
+	wanted := map[string]bool{}
+	for _, t := range targets {
+		wanted[t] = true
+	}
+
+	for t := range s.failures {
+		if !wanted[t] {
+			delete(s.failures, t)
+		}
+	}
+}
+
+// Read the staleness settings from an instance's `stale` key.
+func ParseStaleness(inst *Instance) (*Staleness, error) {
+	section := struct {
+		Stale *Staleness `json:"stale"`
+	}{
+		Stale: NewDefaultStaleness(),
+	}
+
+	// The rest of the section belongs to the exporter.
+	if len(inst.Config) > 0 {
+		if err := json.Unmarshal(inst.Config, &section); err != nil {
+			return nil, validate.Qualify(
+				inst.ProcessName(),
+				&validate.FieldError{Path: "stale", Err: err},
+			)
+		}
+	}
+
+	stale := section.Stale
+	if stale == nil {
+		stale = NewDefaultStaleness()
+	}
+
+	switch stale.Policy {
+	case StaleKeep, StaleMark, StaleDrop:
+	case "":
+		stale.Policy = StaleMark
+
+	default:
+		return nil, validate.Qualify(
+			inst.ProcessName(),
+			&validate.FieldError{
+				Path: "stale.policy",
+				Err:  fmt.Errorf("unknown policy '%s'", stale.Policy),
+			},
+		)
+	}
+
+	if stale.After <= 0 {
+		stale.After = 1
+	}
+
+	return stale, nil
+}
+
+/* stale.go ends here. */
@@ -0,0 +1,171 @@
+/*
+ * stale_test.go --- Staleness configuration tests.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseStaleness(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   *Staleness
+		err    string
+	}{
+		{
+			name: "no section",
+			want: NewDefaultStaleness(),
+		},
+		{
+			name:   "null",
+			config: `{"stale": null}`,
+			want:   NewDefaultStaleness(),
+		},
+		{
+			name:   "empty",
+			config: `{"stale": {}}`,
+			want:   NewDefaultStaleness(),
+		},
+		{
+			name:   "drop after three",
+			config: `{"stale": {"policy": "drop", "after": 3}}`,
+			want:   &Staleness{Policy: StaleDrop, After: 3},
+		},
+		{
+			name:   "unknown policy",
+			config: `{"stale": {"policy": "forget"}}`,
+			err:    "test.stale.policy: unknown policy 'forget'",
+		},
+		{
+			name:   "wrong type",
+			config: `{"stale": "keep"}`,
+			err:    "test.stale: json: cannot unmarshal string into Go struct field .stale of type exporter.Staleness",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst := &Instance{
+				Type:   "test",
+				Name:   "test",
+				Config: json.RawMessage(tt.config),
+			}
+
+			got, err := ParseStaleness(inst)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %s", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetStaleness(t *testing.T) {
+	type outcome struct {
+		target string
+		err    error
+		stale  bool
+		drop   bool
+	}
+
+	tests := []struct {
+		name  string
+		cnf   *Staleness
+		steps []outcome
+	}{
+		{
+			name: "mark",
+			cnf:  &Staleness{Policy: StaleMark, After: 2},
+			steps: []outcome{
+				{target: "a", err: errFailed},
+				{target: "b"},
+				{target: "a", err: errFailed, stale: true},
+				{target: "a"},
+				{target: "a", err: errFailed},
+			},
+		},
+		{
+			name: "drop",
+			cnf:  &Staleness{Policy: StaleDrop, After: 1},
+			steps: []outcome{
+				{target: "a", err: errFailed, stale: true, drop: true},
+				{target: "b"},
+				{target: "a", err: errFailed, stale: true, drop: true},
+				{target: "a"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewTargetStaleness(tt.cnf)
+
+			for idx, step := range tt.steps {
+				stale, drop := s.Track(step.target, step.err)
+				if stale != step.stale || drop != step.drop {
+					t.Errorf("step %d: stale, drop = %v, %v, want %v, %v",
+						idx, stale, drop, step.stale, step.drop)
+				}
+			}
+		})
+	}
+}
+
+func TestTargetStalenessRetain(t *testing.T) {
+	s := NewTargetStaleness(&Staleness{Policy: StaleKeep, After: 2})
+
+	s.Track("gone", errFailed)
+	s.Track("kept", errFailed)
+	s.Retain([]string{"kept"})
+
+	if stale, _ := s.Track("gone", errFailed); stale {
+		t.Error("failures of a forgotten target were kept")
+	}
+
+	if stale, _ := s.Track("kept", errFailed); !stale {
+		t.Error("failures of a retained target were forgotten")
+	}
+}
+
+/* stale_test.go ends here. */
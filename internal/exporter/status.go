@@ -0,0 +1,117 @@
+/*
+ * status.go --- Exporter status.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"time"
+)
+
+const (
+	StateHung    = "hung"    // A scrape has outlived its deadline.
+	StateStopped = "stopped" // The process is no longer running.
+
+	// Argument to `process.Process.Query` asking for a `*Status`.
+	QueryStatus = "status"
+)
+
+// The outcome of a single scrape.
+type Result struct {
+	Time     time.Time `json:"time"`
+	Duration float64   `json:"duration_seconds"`
+	Success  bool      `json:"success"`
+	Skipped  bool      `json:"skipped,omitempty"`
+	Class    string    `json:"class,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func NewResult(start time.Time, err error) *Result {
+	res := &Result{
+		Time:     start,
+		Duration: time.Since(start).Seconds(),
+		Success:  err == nil,
+	}
+
+	if err != nil {
+		res.Class = Classify(err)
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// The state of an exporter instance.
+type Status struct {
+	Name     string  `json:"name"`
+	Exporter string  `json:"exporter"`
+	Instance string  `json:"instance"`
+	State    string  `json:"state"`
+	Interval float64 `json:"interval_seconds"`
+	Timeout  float64 `json:"timeout_seconds"`
+	Failures int64   `json:"consecutive_failures"`
+	Breaker  string  `json:"breaker,omitempty"`
+	Last     *Result `json:"last_scrape"`
+}
+
+// Return the status of the exporter.
+//
+// The state is either running or hung; whether the process itself is
+// still running is up to the caller to determine.
+func (e *Exporter) Status() *Status {
+	timeout := time.Duration(e.timeout.Load())
+
+	st := &Status{
+		Name:     e.name,
+		Exporter: e.inst.Type,
+		Instance: e.inst.Name,
+		State:    StateRunning,
+		Interval: float64(e.Interval()),
+		Timeout:  timeout.Seconds(),
+		Failures: e.failures.Load(),
+		Breaker:  e.breaker.State(""),
+		Last:     e.last.Load(),
+	}
+
+	if e.busy.Load() && time.Since(time.Unix(0, e.started.Load())) > timeout {
+		st.State = StateHung
+	}
+
+	return st
+}
+
+// Answer queries made through the exporter's process.
+func (e *Exporter) query(arg interface{}) interface{} {
+	if arg == QueryStatus {
+		return e.Status()
+	}
+
+	return nil
+}
+
+/* status.go ends here. */
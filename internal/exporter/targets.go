@@ -0,0 +1,120 @@
+/*
+ * targets.go --- Per-target scraping.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Function called for each target, along with its index in the list.
+type TargetFn func(ctx context.Context, idx int, target string) error
+
+// Call `fn` for each target, running no more than `workers` at once.
+//
+// Each call is given an equal share of the time left before the
+// context's deadline, so that slow targets cannot starve those queued
+// behind them.  Targets that are never reached because the context has
+// ended get its error.
+//
+// The error for each target is returned in the same order as the
+// targets, with a panic in `fn` turned into a `PanicError`.  Should the
+// scrape succeed regardless, hand the errors to `TargetPanics` so that
+// any panics are still reported.
+func EachTarget(ctx context.Context, targets []string, workers int, fn TargetFn) []error {
+	errs := make([]error, len(targets))
+	if len(targets) == 0 {
+		return errs
+	}
+
+	if workers > len(targets) {
+		workers = len(targets)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	var share time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		rounds := (len(targets) + workers - 1) / workers
+		share = time.Until(deadline) / time.Duration(rounds)
+	}
+
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for idx := range queue {
+				errs[idx] = eachTarget(ctx, share, idx, targets[idx], fn)
+			}
+		}()
+	}
+
+	for idx := range targets {
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+
+	return errs
+}
+
+func eachTarget(ctx context.Context, share time.Duration, idx int, target string, fn TargetFn) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if share > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, share)
+		defer cancel()
+	}
+
+	defer func() {
+		if val := recover(); val != nil {
+			err = &PanicError{
+				Value:  val,
+				Stack:  debug.Stack(),
+				Target: target,
+			}
+		}
+	}()
+
+	return fn(ctx, idx, target)
+}
+
+/* targets.go ends here. */
@@ -0,0 +1,192 @@
+/*
+ * targets_test.go --- Tests for per-target scraping.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEachTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets int
+		workers int
+		timeout time.Duration
+		fn      TargetFn
+		want    []string // Expected error for each target; "" for none.
+	}{
+		{
+			name:    "no targets",
+			targets: 0,
+			workers: 4,
+			want:    []string{},
+		},
+		{
+			name:    "all succeed",
+			targets: 3,
+			workers: 2,
+			fn:      func(context.Context, int, string) error { return nil },
+			want:    []string{"", "", ""},
+		},
+		{
+			name:    "errors kept in order",
+			targets: 3,
+			workers: 8,
+			fn: func(_ context.Context, idx int, target string) error {
+				if idx == 1 {
+					return fmt.Errorf("%s failed", target)
+				}
+
+				return nil
+			},
+			want: []string{"", "t1 failed", ""},
+		},
+		{
+			name:    "panic",
+			targets: 2,
+			workers: 0,
+			fn: func(_ context.Context, idx int, _ string) error {
+				if idx == 0 {
+					panic("boom")
+				}
+
+				return nil
+			},
+			want: []string{"Panic: boom", ""},
+		},
+		{
+			name:    "slow target times out alone",
+			targets: 3,
+			workers: 3,
+			timeout: 200 * time.Millisecond,
+			fn: func(ctx context.Context, idx int, _ string) error {
+				if idx == 2 {
+					<-ctx.Done()
+
+					return ctx.Err()
+				}
+
+				return nil
+			},
+			want: []string{"", "", context.DeadlineExceeded.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			targets := []string{}
+			for i := 0; i < tt.targets; i++ {
+				targets = append(targets, fmt.Sprintf("t%d", i))
+			}
+
+			errs := EachTarget(ctx, targets, tt.workers, tt.fn)
+			if len(errs) != len(tt.want) {
+				t.Fatalf("got %d errors, want %d", len(errs), len(tt.want))
+			}
+
+			for idx, err := range errs {
+				got := ""
+				if err != nil {
+					got = err.Error()
+				}
+
+				if got != tt.want[idx] {
+					t.Errorf("target %d: error = %q, want %q", idx, got, tt.want[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestEachTargetWorkers(t *testing.T) {
+	var running, most int32
+
+	targets := make([]string, 10)
+	EachTarget(context.Background(), targets, 3, func(context.Context, int, string) error {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			prev := atomic.LoadInt32(&most)
+			if now <= prev || atomic.CompareAndSwapInt32(&most, prev, now) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+
+		return nil
+	})
+
+	if most > 3 {
+		t.Errorf("%d targets ran at once, want at most 3", most)
+	}
+}
+
+func TestEachTargetShare(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Four targets on two workers make two rounds, so each target gets
+	// about half of the time left.
+	targets := make([]string, 4)
+	errs := EachTarget(ctx, targets, 2, func(ctx context.Context, _ int, _ string) error {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return errors.New("no deadline")
+		}
+
+		if left := time.Until(deadline); left > 600*time.Millisecond {
+			return fmt.Errorf("%s left", left)
+		}
+
+		return nil
+	})
+
+	for idx, err := range errs {
+		if err != nil {
+			t.Errorf("target %d: %v", idx, err)
+		}
+	}
+}
+
+/* targets_test.go ends here. */
@@ -0,0 +1,79 @@
+/*
+ * textfile.go --- Files for the node_exporter textfile collector.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package exporter
+
+import (
+	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"errors"
+	"io/fs"
+	"os"
+)
+
+const (
+	// The textfile holding the health of every instance.
+	healthFile string = "master_exporter.prom"
+)
+
+// Write the gathered metrics to the given file, if there is one.
+//
+// The file is replaced atomically, so the collector never sees it half
+// written.
+func writeTextfile(lgr logger.ILogger, file string, gatherer prometheus.Gatherer) {
+	if file == "" || gatherer == nil {
+		return
+	}
+
+	if err := prometheus.WriteToTextfile(file, gatherer); err != nil {
+		lgr.Warn(
+			"Could not write textfile.",
+			"file", file,
+			"err", err.Error(),
+		)
+	}
+}
+
+// Remove the given file, if there is one.
+func removeTextfile(lgr logger.ILogger, file string) {
+	if file == "" {
+		return
+	}
+
+	if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		lgr.Warn(
+			"Could not remove textfile.",
+			"file", file,
+			"err", err.Error(),
+		)
+	}
+}
+
+/* textfile.go ends here. */
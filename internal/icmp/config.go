@@ -29,26 +29,38 @@
 
 package icmp
 
+import (
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"fmt"
+)
+
 type Config struct {
 	Hosts    []string `json:"hosts"`
 	Interval int      `json:"interval"`
+	Timeout  int      `json:"timeout"`
 }
 
 func NewDefaultConfig() *Config {
 	return &Config{
 		Hosts:    []string{},
 		Interval: 20,
+		Timeout:  10,
 	}
 }
 
-func Validate(cnf *Config) {
+// Check the configuration, returning every problem found.
+func Validate(cnf *Config) error {
 	if cnf == nil {
-		return
+		return fmt.Errorf("No configuration.")
 	}
 
-	if cnf.Interval < 10 {
-		cnf.Interval = 10
-	}
+	c := validate.NewChecker()
+	c.Hosts("hosts", cnf.Hosts)
+	c.AtLeast("interval", cnf.Interval, 10)
+	c.Positive("timeout", cnf.Timeout)
+
+	return c.Err()
 }
 
 /* config.go ends here. */
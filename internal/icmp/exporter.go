@@ -30,10 +30,17 @@
 package icmp
 
 import (
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/metrics"
+
 	"github.com/Asmodai/gohacks/logger"
 	probing "github.com/prometheus-community/pro-bing"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 )
 
@@ -42,31 +49,66 @@ var (
 	icmpTtl     int           = 64
 	icmpSize    int           = 24
 	icmpCount   int           = 4
+
+	// Hosts pinged at once.
+	icmpWorkers int = 8
+
+	// Metrics that only mean anything when replies are received.
+	rttMetrics []string = []string{"min_rtt", "avg_rtt", "max_rtt", "stddev_rtt"}
 )
 
+// Settings for a single ping run.
+type Settings struct {
+	Count   int
+	Size    int
+	TTL     int
+	Timeout time.Duration
+}
+
+func NewDefaultSettings() *Settings {
+	return &Settings{
+		Count:   icmpCount,
+		Size:    icmpSize,
+		TTL:     icmpTtl,
+		Timeout: icmpTimeout,
+	}
+}
+
 type Exporter struct {
+	sync.Mutex
+
 	ctx     context.Context
 	logger  logger.ILogger
 	config  *Config
-	metrics *Metrics
+	metrics *metrics.Labelled
+	breaker *exporter.Breaker
+	stale   *exporter.TargetStaleness
 	calls   int
 }
 
-func NewExporter(ctx context.Context, logger logger.ILogger, config *Config) *Exporter {
+func NewExporter(ctx context.Context, logger logger.ILogger, reg prometheus.Registerer, breaker *exporter.Breaker, stale *exporter.Staleness, config *Config) (*Exporter, error) {
+	metrics, err := NewMetrics(reg)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Exporter{
 		ctx:     ctx,
 		logger:  logger,
 		config:  config,
-		metrics: NewMetrics(),
+		metrics: metrics,
+		breaker: breaker,
+		stale:   exporter.NewTargetStaleness(stale),
 		calls:   0,
-	}
+	}, nil
 }
 
-func (e *Exporter) ping(host string) (error, *probing.Statistics) {
+func (e *Exporter) ping(ctx context.Context, host string, settings *Settings) (error, *probing.Statistics) {
 	pinger, err := probing.NewPinger(host)
 	if err != nil {
-		e.logger.Fatal(
+		e.logger.Warn(
 			"Could not create ICMP ping.",
+			"host", host,
 			"err", err.Error(),
 		)
 
@@ -79,12 +121,19 @@ func (e *Exporter) ping(host string) (error, *probing.Statistics) {
 	 * sudo setcap cap_net_raw=+ep /path/to/master-exporter
 	 */
 	pinger.SetPrivileged(true)
-	pinger.Count = icmpCount
-	pinger.Size = icmpSize
-	pinger.Timeout = icmpTimeout
-	pinger.TTL = icmpTtl
+	pinger.Count = settings.Count
+	pinger.Size = settings.Size
+	pinger.Timeout = settings.Timeout
+	pinger.TTL = settings.TTL
+
+	// Don't let a single host outlive the scrape deadline.
+	if deadline, ok := ctx.Deadline(); ok {
+		if remain := time.Until(deadline); remain < pinger.Timeout {
+			pinger.Timeout = remain
+		}
+	}
 
-	err = pinger.Run()
+	err = pinger.RunWithContext(ctx)
 	if err != nil {
 		e.logger.Warn(
 			"Could not ping host.",
@@ -102,40 +151,135 @@ func (e *Exporter) Interval() int {
 	return e.config.Interval
 }
 
-func (e *Exporter) Setup() error {
-	for _, h := range e.config.Hosts {
-		if c := e.metrics.HasHost(h); !c {
-			m := e.metrics.GetHost(h)
+func (e *Exporter) Timeout() int {
+	return e.config.Timeout
+}
 
-			m.AddMetric("packet_loss", "Packet loss.", h)
-			m.AddMetric("min_rtt", "Minimum RTT value. Nanoseconds.", h)
-			m.AddMetric("avg_rtt", "Average RTT value. Nanoseconds.", h)
-			m.AddMetric("max_rtt", "Maximum RTT value. Nanoseconds.", h)
-			m.AddMetric("stddev_rtt", "Standard deviation of RTT value. Nanoseconds.", h)
-		}
+// Ping a single host, returning its statistics.
+//
+// A host whose circuit is open is passed over, and one that sends no
+// replies counts as failing, although its statistics are still returned.
+func (e *Exporter) probe(ctx context.Context, host string) (*probing.Statistics, error) {
+	if err := e.breaker.Allow(host); err != nil {
+		return nil, err
 	}
 
-	return nil
+	err, res := e.ping(ctx, host, NewDefaultSettings())
+	if err == nil && res.PacketsRecv == 0 {
+		err = fmt.Errorf("No replies from '%s'.", host)
+	}
+
+	e.breaker.Done(host, err)
+
+	return res, err
 }
 
-func (e *Exporter) Scrape() error {
-	for _, h := range e.config.Hosts {
-		err, res := e.ping(h)
-		if err != nil {
+// Ping the hosts, several at a time.
+//
+// Each host gets its share of the scrape's deadline, and one that runs
+// out of time has failed like any other.  The scrape only fails if no
+// host could be pinged, so that one host going away does not take the
+// others with it.
+func (e *Exporter) Scrape(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+
+	hosts := e.config.Hosts
+	stats := make([]*probing.Statistics, len(hosts))
+	errs := exporter.EachTarget(ctx, hosts, icmpWorkers,
+		func(ctx context.Context, idx int, host string) (err error) {
+			stats[idx], err = e.probe(ctx, host)
+
 			return err
+		})
+
+	failed := []error{}
+	for idx, h := range hosts {
+		err := errs[idx]
+		stale, drop := e.stale.Track(h, err)
+
+		if stale {
+			e.metrics.Set("up", 0, h)
+		} else {
+			e.metrics.Set("up", 1, h)
 		}
+
+		// A host that sent no replies has still told us its loss.
+		res := stats[idx]
 		if res != nil {
-			m := e.metrics.GetHost(h)
+			e.metrics.Set("packet_loss", res.PacketLoss, h)
+		}
 
-			m.SetMetric("packet_loss", res.PacketLoss)
-			m.SetMetric("min_rtt", float64(res.MinRtt))
-			m.SetMetric("avg_rtt", float64(res.AvgRtt))
-			m.SetMetric("max_rtt", float64(res.MaxRtt))
-			m.SetMetric("stddev_rtt", float64(res.StdDevRtt))
+		if err != nil {
+			if drop {
+				e.metrics.RemoveMetrics(h, rttMetrics...)
+			}
+
+			failed = append(failed, err)
+			continue
 		}
+
+		e.metrics.Set("min_rtt", float64(res.MinRtt), h)
+		e.metrics.Set("avg_rtt", float64(res.AvgRtt), h)
+		e.metrics.Set("max_rtt", float64(res.MaxRtt), h)
+		e.metrics.Set("stddev_rtt", float64(res.StdDevRtt), h)
+	}
+
+	if len(failed) == len(hosts) {
+		return errors.Join(failed...)
+	}
+
+	return exporter.TargetPanics(errs)
+}
+
+// Apply a new configuration, forgetting hosts that are gone.
+func (e *Exporter) Reload(inst *exporter.Instance) error {
+	cnf, err := decodeConfig(inst)
+	if err != nil {
+		return err
+	}
+
+	bcnf, err := exporter.ParseBreaker(inst)
+	if err != nil {
+		return err
 	}
 
+	stale, err := exporter.ParseStaleness(inst)
+	if err != nil {
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.config = cnf
+	e.metrics.Retain(cnf.Hosts)
+	e.breaker.SetConfig(bcnf)
+	e.breaker.Retain(cnf.Hosts)
+	e.stale.SetConfig(stale)
+	e.stale.Retain(cnf.Hosts)
+
 	return nil
 }
 
+// Delete the round trip times until the next successful scrape.
+//
+// Every host is down by now, which `up` and `packet_loss` still show.
+func (e *Exporter) Drop() {
+	e.Lock()
+	defer e.Unlock()
+
+	for _, h := range e.metrics.Targets() {
+		e.metrics.RemoveMetrics(h, rttMetrics...)
+	}
+}
+
+func (e *Exporter) Close() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.metrics.Unregister()
+	e.breaker.Close()
+}
+
 /* exporter.go ends here. */
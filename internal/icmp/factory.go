@@ -0,0 +1,92 @@
+/*
+ * factory.go --- Exporter factory.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package icmp
+
+import (
+	"github.com/Asmodai/master-exporter/internal/exporter"
+
+	"errors"
+)
+
+func init() {
+	exporter.Register("icmp", Factory)
+	exporter.RegisterCheck("icmp", Check)
+}
+
+func decodeConfig(inst *exporter.Instance) (*Config, error) {
+	cnf := NewDefaultConfig()
+
+	// Report decoding problems along with anything else that is wrong.
+	err := errors.Join(exporter.Decode(inst.Config, cnf), Validate(cnf))
+	if err != nil {
+		return nil, err
+	}
+
+	return cnf, nil
+}
+
+func Check(inst *exporter.Instance) error {
+	_, err := decodeConfig(inst)
+
+	return err
+}
+
+func Factory(deps *exporter.Deps, inst *exporter.Instance) (exporter.IExporter, error) {
+	cnf, err := decodeConfig(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	bcnf, err := exporter.ParseBreaker(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	stale, err := exporter.ParseStaleness(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	breaker, err := exporter.NewTargetBreaker(deps, inst, bcnf)
+	if err != nil {
+		return nil, err
+	}
+
+	exp, err := NewExporter(deps.Context, deps.Logger, deps.Registerer, breaker, stale, cnf)
+	if err != nil {
+		breaker.Close()
+
+		return nil, err
+	}
+
+	return exp, nil
+}
+
+/* factory.go ends here. */
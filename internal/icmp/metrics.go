@@ -30,85 +30,26 @@
 package icmp
 
 import (
+	"github.com/Asmodai/master-exporter/internal/metrics"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-type IcmpMetrics struct {
-	Metric map[string]prometheus.Gauge
-}
-
-func NewIcmpMetrics() *IcmpMetrics {
-	return &IcmpMetrics{
-		Metric: map[string]prometheus.Gauge{},
-	}
-}
-
-func (im *IcmpMetrics) AddMetric(name, help, pretty string) {
-	if im.Metric == nil {
-		im.Metric = map[string]prometheus.Gauge{}
-	}
-
-	if _, ok := im.Metric[name]; !ok {
-		im.Metric[name] = prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: "icmp",
-			Name:      name,
-			Help:      help,
-			ConstLabels: map[string]string{
-				"host": pretty,
-			},
-		})
-		_ = prometheus.Register(im.Metric[name])
-	}
-}
-
-func (im *IcmpMetrics) SetMetric(name string, value float64) {
-	if _, ok := im.Metric[name]; !ok {
-		return
-	}
-
-	im.Metric[name].Set(value)
-}
-
-// =================================================================
-
-type Metrics struct {
-	metrics map[string]*IcmpMetrics
-}
-
-func NewMetrics() *Metrics {
-	return &Metrics{
-		metrics: map[string]*IcmpMetrics{},
-	}
-}
-
-func (m *Metrics) Keys() []string {
-	keys := []string{}
-
-	for k := range m.metrics {
-		keys = append(keys, k)
-	}
-
-	return keys
-}
-
-func (m *Metrics) HasHost(key string) bool {
-	_, ok := m.metrics[key]
-
-	return ok
-}
-
-func (m *Metrics) AddHost(key string) {
-	if _, ok := m.metrics[key]; ok {
-		return
+// Create the metrics for an exporter, labelled by host.
+func NewMetrics(reg prometheus.Registerer) (*metrics.Labelled, error) {
+	m := metrics.NewLabelled(reg, "icmp", "host")
+	m.Gauge("up", "Is the host's data fresh?")
+	m.Gauge("packet_loss", "Packet loss.")
+	m.Gauge("min_rtt", "Minimum RTT value. Nanoseconds.")
+	m.Gauge("avg_rtt", "Average RTT value. Nanoseconds.")
+	m.Gauge("max_rtt", "Maximum RTT value. Nanoseconds.")
+	m.Gauge("stddev_rtt", "Standard deviation of RTT value. Nanoseconds.")
+
+	if err := m.Err(); err != nil {
+		return nil, err
 	}
 
-	m.metrics[key] = NewIcmpMetrics()
-}
-
-func (m *Metrics) GetHost(key string) *IcmpMetrics {
-	m.AddHost(key)
-
-	return m.metrics[key]
+	return m, nil
 }
 
 /* metrics.go ends here. */
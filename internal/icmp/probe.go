@@ -0,0 +1,96 @@
+/*
+ * probe.go --- ICMP prober.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package icmp
+
+import (
+	"github.com/Asmodai/master-exporter/internal/probe"
+
+	"github.com/Asmodai/gohacks/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"context"
+	"time"
+)
+
+func init() {
+	probe.Register("icmp", Probe)
+}
+
+func moduleSettings(mod *probe.Module) *Settings {
+	settings := NewDefaultSettings()
+
+	if mod.Count > 0 {
+		settings.Count = mod.Count
+	}
+
+	if mod.Size > 0 {
+		settings.Size = mod.Size
+	}
+
+	if mod.TTL > 0 {
+		settings.TTL = mod.TTL
+	}
+
+	settings.Timeout = time.Duration(mod.Timeout) * time.Second
+
+	return settings
+}
+
+func newProbeGauge(reg prometheus.Registerer, name, help string) prometheus.Gauge {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "icmp",
+		Name:      name,
+		Help:      help,
+	})
+	reg.MustRegister(gauge)
+
+	return gauge
+}
+
+// Ping a single target using the settings in the given module.
+func Probe(ctx context.Context, mod *probe.Module, target string, reg prometheus.Registerer, lgr logger.ILogger) error {
+	e := &Exporter{logger: lgr}
+
+	err, res := e.ping(ctx, target, moduleSettings(mod))
+	if err != nil {
+		return err
+	}
+
+	newProbeGauge(reg, "packet_loss", "Packet loss.").Set(res.PacketLoss)
+	newProbeGauge(reg, "min_rtt", "Minimum RTT value. Nanoseconds.").Set(float64(res.MinRtt))
+	newProbeGauge(reg, "avg_rtt", "Average RTT value. Nanoseconds.").Set(float64(res.AvgRtt))
+	newProbeGauge(reg, "max_rtt", "Maximum RTT value. Nanoseconds.").Set(float64(res.MaxRtt))
+	newProbeGauge(reg, "stddev_rtt", "Standard deviation of RTT value. Nanoseconds.").Set(float64(res.StdDevRtt))
+
+	return nil
+}
+
+/* probe.go ends here. */
@@ -0,0 +1,151 @@
+/*
+ * encode.go --- Exposition formats.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package metrics
+
+import (
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	FormatText        string = "text"
+	FormatOpenMetrics string = "openmetrics"
+	FormatJSON        string = "json"
+)
+
+type jsonMetric struct {
+	Labels map[string]string `json:"labels"`
+	Value  interface{}       `json:"value"`
+}
+
+type jsonFamily struct {
+	Name    string        `json:"name"`
+	Help    string        `json:"help"`
+	Type    string        `json:"type"`
+	Metrics []*jsonMetric `json:"metrics"`
+}
+
+// Write gathered metrics in the given format.
+func Encode(w io.Writer, mfs []*dto.MetricFamily, format string) error {
+	switch format {
+	case FormatText, FormatOpenMetrics:
+		fmtType := expfmt.FmtText
+		if format == FormatOpenMetrics {
+			fmtType = expfmt.FmtOpenMetrics
+		}
+
+		enc := expfmt.NewEncoder(w, fmtType)
+		for _, mf := range mfs {
+			if err := enc.Encode(mf); err != nil {
+				return err
+			}
+		}
+
+		// Writes the OpenMetrics `# EOF` marker.
+		if closer, ok := enc.(expfmt.Closer); ok {
+			return closer.Close()
+		}
+
+		return nil
+
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(toJSON(mfs))
+	}
+
+	return fmt.Errorf("Unknown format '%s'", format)
+}
+
+// JSON has no representation for NaN or the infinities.
+func jsonValue(v float64) interface{} {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprintf("%g", v)
+	}
+
+	return v
+}
+
+func toJSON(mfs []*dto.MetricFamily) []*jsonFamily {
+	families := []*jsonFamily{}
+
+	for _, mf := range mfs {
+		family := &jsonFamily{
+			Name:    mf.GetName(),
+			Help:    mf.GetHelp(),
+			Type:    mf.GetType().String(),
+			Metrics: []*jsonMetric{},
+		}
+
+		for _, m := range mf.GetMetric() {
+			metric := &jsonMetric{Labels: map[string]string{}}
+			for _, lp := range m.GetLabel() {
+				metric.Labels[lp.GetName()] = lp.GetValue()
+			}
+
+			switch {
+			case m.Gauge != nil:
+				metric.Value = jsonValue(m.GetGauge().GetValue())
+
+			case m.Counter != nil:
+				metric.Value = jsonValue(m.GetCounter().GetValue())
+
+			case m.Untyped != nil:
+				metric.Value = jsonValue(m.GetUntyped().GetValue())
+
+			case m.Summary != nil:
+				metric.Value = map[string]interface{}{
+					"count": m.GetSummary().GetSampleCount(),
+					"sum":   jsonValue(m.GetSummary().GetSampleSum()),
+				}
+
+			case m.Histogram != nil:
+				metric.Value = map[string]interface{}{
+					"count": m.GetHistogram().GetSampleCount(),
+					"sum":   jsonValue(m.GetHistogram().GetSampleSum()),
+				}
+			}
+
+			family.Metrics = append(family.Metrics, metric)
+		}
+
+		families = append(families, family)
+	}
+
+	return families
+}
+
+/* encode.go ends here. */
@@ -31,11 +31,10 @@ package metrics
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-func NewMetricsGauge(name, exporter string) prometheus.Gauge {
-	return promauto.NewGauge(prometheus.GaugeOpts{
+func NewMetricsGauge(group *Group, name, exporter string) prometheus.Gauge {
+	return group.Gauge(prometheus.GaugeOpts{
 		Namespace: "metrics",
 		Name:      name,
 		Help:      "Metrics gauge.",
@@ -45,4 +44,17 @@ func NewMetricsGauge(name, exporter string) prometheus.Gauge {
 	})
 }
 
+// Create a registry for the whole application, along with the Go runtime
+// and process collectors that the default registry would have provided.
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	return reg
+}
+
 /* funcs.go ends here. */
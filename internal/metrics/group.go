@@ -0,0 +1,118 @@
+/*
+ * group.go --- Groups of registered collectors.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"errors"
+)
+
+// A group of collectors registered with the same registerer.
+//
+// The group remembers every collector it registers so that they can all
+// be unregistered together, and collects registration errors so that
+// callers can build a whole set of metrics before checking for failure.
+type Group struct {
+	reg        prometheus.Registerer
+	collectors []prometheus.Collector
+	errs       []error
+}
+
+func NewGroup(reg prometheus.Registerer) *Group {
+	return &Group{
+		reg:        reg,
+		collectors: []prometheus.Collector{},
+		errs:       []error{},
+	}
+}
+
+// Register a collector, recording any error.
+func (g *Group) Register(c prometheus.Collector) error {
+	if err := g.reg.Register(c); err != nil {
+		g.errs = append(g.errs, err)
+
+		return err
+	}
+
+	g.collectors = append(g.collectors, c)
+
+	return nil
+}
+
+// Create and register a gauge.
+func (g *Group) Gauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	gauge := prometheus.NewGauge(opts)
+	_ = g.Register(gauge)
+
+	return gauge
+}
+
+// Unregister a single collector from the group.
+func (g *Group) Unregister(c prometheus.Collector) {
+	for idx := range g.collectors {
+		if g.collectors[idx] == c {
+			g.reg.Unregister(c)
+			g.collectors = append(g.collectors[:idx], g.collectors[idx+1:]...)
+
+			return
+		}
+	}
+}
+
+// Unregister every collector in the group.
+//
+// The collectors remain members of the group, and can be registered
+// again with `RegisterAll`.
+func (g *Group) UnregisterAll() {
+	for _, c := range g.collectors {
+		g.reg.Unregister(c)
+	}
+}
+
+// Register every collector in the group again.
+func (g *Group) RegisterAll() error {
+	errs := []error{}
+
+	for _, c := range g.collectors {
+		if err := g.reg.Register(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Return all registration errors seen so far, or nil.
+func (g *Group) Err() error {
+	return errors.Join(g.errs...)
+}
+
+/* group.go ends here. */
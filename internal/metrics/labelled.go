@@ -0,0 +1,216 @@
+/*
+ * labelled.go --- Labelled metrics for multiple targets.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sort"
+)
+
+// A family of labelled metrics sharing the same label names.
+//
+// Each metric is a `GaugeVec` or `CounterVec`, with series created on
+// first use.  The first label identifies the target (host, switch, etc),
+// and removing a target deletes every series carrying it, so metrics for
+// targets that have gone away disappear rather than freezing at their
+// last value.
+//
+// Callers are expected to provide their own locking.
+type Labelled struct {
+	namespace string
+	labels    []string
+	gauges    map[string]*prometheus.GaugeVec
+	counters  map[string]*prometheus.CounterVec
+	targets   map[string]bool
+	group     *Group
+}
+
+func NewLabelled(reg prometheus.Registerer, namespace string, labels ...string) *Labelled {
+	return &Labelled{
+		namespace: namespace,
+		labels:    labels,
+		gauges:    map[string]*prometheus.GaugeVec{},
+		counters:  map[string]*prometheus.CounterVec{},
+		targets:   map[string]bool{},
+		group:     NewGroup(reg),
+	}
+}
+
+// Define and register a gauge.
+func (l *Labelled) Gauge(name, help string) {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: l.namespace,
+		Name:      name,
+		Help:      help,
+	}, l.labels)
+
+	if l.group.Register(vec) == nil {
+		l.gauges[name] = vec
+	}
+}
+
+// Define and register a counter.
+func (l *Labelled) Counter(name, help string) {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: l.namespace,
+		Name:      name,
+		Help:      help,
+	}, l.labels)
+
+	if l.group.Register(vec) == nil {
+		l.counters[name] = vec
+	}
+}
+
+// Return any errors from defining metrics.
+//
+// If there were errors, everything that was registered is unregistered
+// again.
+func (l *Labelled) Err() error {
+	err := l.group.Err()
+	if err != nil {
+		l.group.UnregisterAll()
+	}
+
+	return err
+}
+
+// Set the value of a gauge for the given label values.
+//
+// Unknown metrics and label values that do not match the labels are
+// ignored.
+func (l *Labelled) Set(name string, value float64, lvs ...string) {
+	vec, ok := l.gauges[name]
+	if !ok {
+		return
+	}
+
+	gauge, err := vec.GetMetricWithLabelValues(lvs...)
+	if err != nil {
+		return
+	}
+
+	gauge.Set(value)
+	l.targets[lvs[0]] = true
+}
+
+// Add to a counter for the given label values.
+func (l *Labelled) Add(name string, value float64, lvs ...string) {
+	vec, ok := l.counters[name]
+	if !ok {
+		return
+	}
+
+	counter, err := vec.GetMetricWithLabelValues(lvs...)
+	if err != nil {
+		return
+	}
+
+	counter.Add(value)
+	l.targets[lvs[0]] = true
+}
+
+// Return all targets that currently have series.
+func (l *Labelled) Targets() []string {
+	targets := []string{}
+
+	for k := range l.targets {
+		targets = append(targets, k)
+	}
+	sort.Strings(targets)
+
+	return targets
+}
+
+// Delete every series for the given target.
+func (l *Labelled) Remove(target string) {
+	match := prometheus.Labels{l.labels[0]: target}
+
+	for _, vec := range l.gauges {
+		vec.DeletePartialMatch(match)
+	}
+
+	for _, vec := range l.counters {
+		vec.DeletePartialMatch(match)
+	}
+
+	delete(l.targets, target)
+}
+
+// Delete the series of the named metrics for the given target, leaving
+// its other series in place.
+func (l *Labelled) RemoveMetrics(target string, names ...string) {
+	match := prometheus.Labels{l.labels[0]: target}
+
+	for _, name := range names {
+		if vec, ok := l.gauges[name]; ok {
+			vec.DeletePartialMatch(match)
+		}
+
+		if vec, ok := l.counters[name]; ok {
+			vec.DeletePartialMatch(match)
+		}
+	}
+}
+
+// Delete every series for targets not in the given list.
+//
+// Returns the targets that were removed.
+func (l *Labelled) Retain(targets []string) []string {
+	wanted := map[string]bool{}
+	for _, t := range targets {
+		wanted[t] = true
+	}
+
+	removed := []string{}
+	for _, t := range l.Targets() {
+		if !wanted[t] {
+			l.Remove(t)
+			removed = append(removed, t)
+		}
+	}
+
+	return removed
+}
+
+// Delete every series for every target.
+func (l *Labelled) RemoveAll() {
+	for _, t := range l.Targets() {
+		l.Remove(t)
+	}
+}
+
+// Unregister all metrics.
+func (l *Labelled) Unregister() {
+	l.group.UnregisterAll()
+}
+
+/* labelled.go ends here. */
@@ -0,0 +1,128 @@
+/*
+ * self.go --- Self-instrumentation.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"runtime"
+	"time"
+)
+
+const (
+	selfNamespace string = "master_exporter"
+)
+
+// Metrics about the exporter itself: what build it is, and what
+// configuration it is running.
+type Self struct {
+	group    *Group
+	build    *prometheus.GaugeVec
+	hash     prometheus.Gauge
+	success  prometheus.Gauge
+	reloaded prometheus.Gauge
+	enabled  *prometheus.GaugeVec
+}
+
+func NewSelf(reg prometheus.Registerer) (*Self, error) {
+	s := &Self{
+		group: NewGroup(reg),
+		build: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: selfNamespace,
+				Name:      "build_info",
+				Help:      "Build information.  Always 1.",
+			},
+			[]string{"version", "revision", "goversion"},
+		),
+		enabled: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: selfNamespace,
+				Name:      "enabled_exporter_info",
+				Help:      "Exporter instances enabled in the configuration.  Always 1.",
+			},
+			[]string{"exporter", "instance"},
+		),
+	}
+
+	_ = s.group.Register(s.build)
+	_ = s.group.Register(s.enabled)
+
+	s.hash = s.group.Gauge(prometheus.GaugeOpts{
+		Namespace: selfNamespace,
+		Name:      "config_hash",
+		Help:      "Hash of the loaded configuration.",
+	})
+	s.success = s.group.Gauge(prometheus.GaugeOpts{
+		Namespace: selfNamespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload succeeded.",
+	})
+	s.reloaded = s.group.Gauge(prometheus.GaugeOpts{
+		Namespace: selfNamespace,
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Time of the last successful configuration load.",
+	})
+
+	if err := s.group.Err(); err != nil {
+		s.group.UnregisterAll()
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Self) SetBuild(version, revision string) {
+	s.build.WithLabelValues(version, revision, runtime.Version()).Set(1)
+}
+
+// Record a successful configuration load.
+//
+// `enabled` maps each enabled exporter to the names of its instances.
+func (s *Self) SetConfig(hash uint64, enabled map[string][]string) {
+	s.hash.Set(float64(hash))
+	s.success.Set(1)
+	s.reloaded.Set(float64(time.Now().Unix()))
+
+	s.enabled.Reset()
+	for exporter, insts := range enabled {
+		for _, inst := range insts {
+			s.enabled.WithLabelValues(exporter, inst).Set(1)
+		}
+	}
+}
+
+// Record a failed configuration reload.
+func (s *Self) SetFailed() {
+	s.success.Set(0)
+}
+
+/* self.go ends here. */
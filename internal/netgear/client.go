@@ -0,0 +1,187 @@
+/*
+ * client.go --- NSDP client.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package netgear
+
+import (
+	"github.com/yaamai/go-nsdp/nsdp"
+
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	transmitInterval time.Duration = 300 * time.Millisecond
+	transmitRetry    int           = 5
+)
+
+// NSDP client that owns its socket.
+//
+// The client in go-nsdp binds the fixed NSDP port and has no way of
+// releasing it, so an exporter could never be restarted.  We use its
+// message encoding and do the I/O ourselves.
+type Client struct {
+	sync.Mutex
+
+	conn   *net.UDPConn
+	target *net.UDPAddr
+	hwaddr net.HardwareAddr
+	seq    uint16
+	buf    []byte
+}
+
+func NewClient() (*Client, error) {
+	iface, self, err := GetSelf()
+	if err != nil {
+		return nil, err
+	}
+
+	listen, err := GetUDP(self, nsdp.DefaultRecvPort)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := GetUDP(nsdp.DefaultDestAddr, nsdp.DefaultSendPort)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", listen)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn:   conn,
+		target: target,
+		hwaddr: iface.HardwareAddr,
+		seq:    uint16(rand.Intn(0xffff)),
+		buf:    make([]byte, nsdp.DefaultReceiveBufferSize),
+	}, nil
+}
+
+// Broadcast a read request for the given TLVs and wait for a reply.
+//
+// The request is sent again every `transmitInterval` until a reply
+// with a matching sequence number arrives or the context's deadline
+// passes.  Late replies to earlier requests are discarded.
+func (c *Client) Read(ctx context.Context, tlvs ...nsdp.TLV) (*nsdp.Msg, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.seq++
+
+	msg := nsdp.Msg(nsdp.DefaultMsg)
+	msg.Op = 1
+	msg.Seq = c.seq
+	msg.HostMac = c.hwaddr
+	msg.Body = nsdp.Body(tlvs)
+
+	req, err := msg.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(transmitInterval * time.Duration(transmitRetry))
+	}
+
+	for retry := 0; retry < transmitRetry; retry++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if _, err := c.conn.WriteTo(req, c.target); err != nil {
+			return nil, err
+		}
+
+		wait := time.Now().Add(transmitInterval)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+
+		resp, err := c.recv(wait)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp != nil {
+			return resp, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, context.DeadlineExceeded
+		}
+	}
+
+	return nil, fmt.Errorf("No response from any switch.")
+}
+
+// Wait until `deadline` for a reply to the current request.
+//
+// Returns nil without an error if the deadline passes.
+func (c *Client) recv(deadline time.Time) (*nsdp.Msg, error) {
+	if err := c.conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	for {
+		n, _, err := c.conn.ReadFrom(c.buf)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				return nil, nil
+			}
+
+			return nil, err
+		}
+
+		resp, err := nsdp.NewMsgFromBinary(c.buf[:n])
+		if err != nil || resp == nil {
+			continue
+		}
+
+		if resp.Op != 2 || resp.Seq != c.seq {
+			continue
+		}
+
+		return resp, nil
+	}
+}
+
+// Release the socket.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+/* client.go ends here. */
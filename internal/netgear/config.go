@@ -29,17 +29,40 @@
 
 package netgear
 
+import (
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"fmt"
+)
+
 type Config struct {
 	Interval int `json:"interval"`
+	Timeout  int `json:"timeout"`
+
+	// Seconds a switch may go unseen before its series are deleted.
+	Expire int `json:"expire"`
 }
 
 func NewDefaultConfig() *Config {
 	return &Config{
 		Interval: 20,
+		Timeout:  5,
+		Expire:   300,
 	}
 }
 
-func Validate(cnf *Config) {
+// Check the configuration, returning every problem found.
+func Validate(cnf *Config) error {
+	if cnf == nil {
+		return fmt.Errorf("No configuration.")
+	}
+
+	c := validate.NewChecker()
+	c.Positive("interval", cnf.Interval)
+	c.Positive("timeout", cnf.Timeout)
+	c.Positive("expire", cnf.Expire)
+
+	return c.Err()
 }
 
 /* config.go ends here. */
@@ -30,12 +30,17 @@
 package netgear
 
 import (
-	//"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/exporter"
+
 	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/yaamai/go-nsdp/nsdp"
 
 	"context"
+	"fmt"
+	"sync"
+	"time"
 )
 
 var (
@@ -45,21 +50,28 @@ var (
 type NsdpValues map[string]interface{}
 
 type Exporter struct {
+	sync.Mutex
+
 	ctx     context.Context
 	logger  logger.ILogger
 	config  *Config
-	client  *nsdp.Client
+	client  *Client
 	metrics *Metrics
+	seen    map[string]time.Time
 	calls   int
 }
 
-func NewExporter(ctx context.Context, logger logger.ILogger, config *Config) *Exporter {
-	nsdpClient, err := nsdp.NewDefaultClient()
+func NewExporter(ctx context.Context, logger logger.ILogger, reg prometheus.Registerer, config *Config) (*Exporter, error) {
+	nsdpClient, err := NewClient()
 	if err != nil {
-		logger.Fatal(
-			"Could not create NSDP client.",
-			"err", err.Error(),
-		)
+		return nil, fmt.Errorf("Could not create NSDP client: %s", err)
+	}
+
+	metrics, err := NewMetrics(reg)
+	if err != nil {
+		_ = nsdpClient.Close()
+
+		return nil, err
 	}
 
 	return &Exporter{
@@ -67,19 +79,20 @@ func NewExporter(ctx context.Context, logger logger.ILogger, config *Config) *Ex
 		logger:  logger,
 		config:  config,
 		client:  nsdpClient,
-		metrics: NewMetrics(),
+		metrics: metrics,
+		seen:    map[string]time.Time{},
 		calls:   0,
-	}
+	}, nil
 }
 
 func (e *Exporter) check(vals NsdpValues) {
-	for _, k := range e.metrics.Keys() {
-		e.metrics.GetSwitch(k).SetMetric("up", 0)
+	for _, k := range e.metrics.Switches() {
+		e.metrics.SetSwitch("up", k, 0)
 
 		for key, val := range vals {
 			if key == "host_name" {
-				if val.(*nsdp.HostName).String() == k {
-					e.metrics.GetSwitch(k).SetMetric("up", 1)
+				if name, ok := val.(*nsdp.HostName); ok && name.String() == k {
+					e.metrics.SetSwitch("up", k, 1)
 					continue
 				}
 			}
@@ -87,117 +100,112 @@ func (e *Exporter) check(vals NsdpValues) {
 	}
 }
 
+// Delete the series of any switch that has not been seen for a while.
+func (e *Exporter) expire() {
+	limit := time.Duration(e.config.Expire) * time.Second
+
+	for _, k := range e.metrics.Switches() {
+		if time.Since(e.seen[k]) > limit {
+			e.logger.Info(
+				"Switch has gone away.",
+				"switch", k,
+			)
+
+			e.metrics.RemoveSwitch(k)
+			delete(e.seen, k)
+		}
+	}
+}
+
+// Return a value as a list of TLVs.
+//
+// A tag that appears once, such as the port status of a switch with a
+// single port, gives a lone TLV rather than a list.
+func tlvList(val interface{}) []nsdp.TLV {
+	switch v := val.(type) {
+	case []nsdp.TLV:
+		return v
+
+	case nsdp.TLV:
+		return []nsdp.TLV{v}
+	}
+
+	return []nsdp.TLV{}
+}
+
 func (e *Exporter) process(vals NsdpValues) {
 	var hostname string
 	var addr *nsdp.HostIPAddress
 	var portstatus []nsdp.TLV = []nsdp.TLV{}
 	var portstats []nsdp.TLV = []nsdp.TLV{}
-	var created bool
 
 	for key, val := range vals {
 		switch key {
 		case "host_name":
-			hostname = val.(*nsdp.HostName).String()
-			created = e.metrics.HasSwitch(hostname)
+			if name, ok := val.(*nsdp.HostName); ok {
+				hostname = name.String()
+			}
 
 		case "ip":
-			addr = val.(*nsdp.HostIPAddress)
+			addr, _ = val.(*nsdp.HostIPAddress)
 
 		case "port_link_status":
-			portstatus = val.([]nsdp.TLV)
+			portstatus = tlvList(val)
 
 		case "port_statistics":
-			portstats = val.([]nsdp.TLV)
+			portstats = tlvList(val)
 		}
 	}
 
 	if len(hostname) == 0 {
+		where := "unknown"
+		if addr != nil {
+			where = addr.String()
+		}
+
 		e.logger.Warn(
 			"Switch is not returning a hostname.",
-			"addr", addr.String(),
+			"addr", where,
 		)
 
 		return
 	}
 
-	if !created {
-		e.metrics.AddSwitch(hostname)
-
-		e.metrics.GetSwitch(hostname).AddMetric(
-			"up",
-			"Is the given switch online?",
-			hostname,
-		)
-	}
+	e.seen[hostname] = time.Now()
+	e.metrics.SetSwitch("up", hostname, 1)
 
 	for idx := range portstatus {
-		stat := portstatus[idx].(*nsdp.PortLinkStatus)
-
-		if !created {
-			e.metrics.GetSwitch(hostname).AddPortMetric(
-				"speed",
-				"Port speed.",
-				hostname,
-				idx,
-			)
+		stat, ok := portstatus[idx].(*nsdp.PortLinkStatus)
+		if !ok {
+			continue
 		}
 
-		e.metrics.GetSwitch(hostname).SetPortMetric("speed", idx, uint64(stat.Speed))
+		e.metrics.SetPort("speed", hostname, idx, uint64(stat.Speed))
 	}
 
 	for idx := range portstats {
-		stat := portstats[idx].(*nsdp.PortStatistics)
-
-		if !created {
-			e.metrics.GetSwitch(hostname).AddPortMetric(
-				"rx_total_bytes",
-				"Total bytes received for a port.",
-				hostname,
-				idx,
-			)
-			e.metrics.GetSwitch(hostname).AddPortMetric(
-				"tx_total_bytes",
-				"Total bytes transmitted for a port.",
-				hostname,
-				idx,
-			)
-			e.metrics.GetSwitch(hostname).AddPortMetric(
-				"packets",
-				"Total packets on this port.",
-				hostname,
-				idx,
-			)
-			e.metrics.GetSwitch(hostname).AddPortMetric(
-				"packets_bcast",
-				"Total broadcast packets on this port.",
-				hostname,
-				idx,
-			)
-			e.metrics.GetSwitch(hostname).AddPortMetric(
-				"packets_mcast",
-				"Total multicast packets on this port.",
-				hostname,
-				idx,
-			)
-			e.metrics.GetSwitch(hostname).AddPortMetric(
-				"crc_errors",
-				"Total CRC errors on this port.",
-				hostname,
-				idx,
-			)
+		stat, ok := portstats[idx].(*nsdp.PortStatistics)
+		if !ok {
+			continue
 		}
 
-		e.metrics.GetSwitch(hostname).SetPortMetric("rx_total_bytes", idx, uint64(stat.Recv))
-		e.metrics.GetSwitch(hostname).SetPortMetric("tx_total_bytes", idx, uint64(stat.Send))
-		e.metrics.GetSwitch(hostname).SetPortMetric("packets", idx, uint64(stat.Pkt))
-		e.metrics.GetSwitch(hostname).SetPortMetric("packets_bcast", idx, uint64(stat.Broadcast))
-		e.metrics.GetSwitch(hostname).SetPortMetric("packets_mcast", idx, uint64(stat.Multicast))
-		e.metrics.GetSwitch(hostname).SetPortMetric("crx_errors", idx, uint64(stat.Error))
+		e.metrics.SetPort("rx_total_bytes", hostname, idx, uint64(stat.Recv))
+		e.metrics.SetPort("tx_total_bytes", hostname, idx, uint64(stat.Send))
+		e.metrics.SetPort("packets", hostname, idx, uint64(stat.Pkt))
+		e.metrics.SetPort("packets_bcast", hostname, idx, uint64(stat.Broadcast))
+		e.metrics.SetPort("packets_mcast", hostname, idx, uint64(stat.Multicast))
+		e.metrics.SetPort("crc_errors", hostname, idx, uint64(stat.Error))
 	}
 }
 
-func (e *Exporter) poll() error {
-	resp, err := e.client.Read(tlvs...)
+// The read gives up at the context's deadline, leaving nothing behind
+// on the socket for the next scrape to trip over.
+func (e *Exporter) read(ctx context.Context) (*nsdp.Msg, error) {
+	return e.client.Read(ctx, tlvs...)
+}
+
+func (e *Exporter) poll(ctx context.Context) error {
+	resp, err := e.read(ctx)
 	if err != nil {
 		return err
 	}
@@ -205,14 +213,8 @@ func (e *Exporter) poll() error {
 	tlvmap := NsdpValues{}
 	for _, tlv := range resp.Body {
 		tname := tlv.Tag().String()
-		if _, ok := tlvmap[tname]; ok {
-			array, ok := tlvmap[tname].([]nsdp.TLV)
-			if !ok {
-				prev := tlvmap[tname]
-				tlvmap[tname] = []nsdp.TLV{prev.(nsdp.TLV), tlv}
-			} else {
-				tlvmap[tname] = append(array, tlv)
-			}
+		if prev, ok := tlvmap[tname]; ok {
+			tlvmap[tname] = append(tlvList(prev), tlv)
 		} else {
 			tlvmap[tname] = tlv
 		}
@@ -220,6 +222,7 @@ func (e *Exporter) poll() error {
 
 	e.check(tlvmap)
 	e.process(tlvmap)
+	e.expire()
 
 	return nil
 }
@@ -228,8 +231,54 @@ func (e *Exporter) Interval() int {
 	return e.config.Interval
 }
 
-func (e *Exporter) Scrape() error {
-	return e.poll()
+func (e *Exporter) Timeout() int {
+	return e.config.Timeout
+}
+
+func (e *Exporter) Scrape(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+
+	return e.poll(ctx)
+}
+
+func (e *Exporter) Reload(inst *exporter.Instance) error {
+	cnf, err := decodeConfig(inst)
+	if err != nil {
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.config = cnf
+
+	return nil
+}
+
+// Delete all series until the next successful poll.
+func (e *Exporter) Drop() {
+	e.Lock()
+	defer e.Unlock()
+
+	for _, k := range e.metrics.Switches() {
+		e.metrics.RemoveSwitch(k)
+		delete(e.seen, k)
+	}
+}
+
+func (e *Exporter) Close() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.metrics.Unregister()
+
+	if err := e.client.Close(); err != nil {
+		e.logger.Warn(
+			"Could not close NSDP client.",
+			"err", err.Error(),
+		)
+	}
 }
 
 /* exporter.go ends here. */
@@ -1,7 +1,7 @@
 /*
- * icmp.go --- ICMP exporter.
+ * factory.go --- Exporter factory.
  *
- * Copyright (c) 2022-2024 Paul Ward <asmodai@gmail.com>
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
  *
  * Author:     Paul Ward <asmodai@gmail.com>
  * Maintainer: Paul Ward <asmodai@gmail.com>
@@ -27,51 +27,52 @@
  * SOFTWARE.
  */
 
-package main
+package netgear
 
 import (
-	"github.com/Asmodai/gohacks/utils"
-
-	"github.com/Asmodai/master-exporter/internal/config"
 	"github.com/Asmodai/master-exporter/internal/exporter"
-	"github.com/Asmodai/master-exporter/internal/icmp"
+
+	"errors"
 )
 
-func (m *MasterExporter) initIcmp() {
-	cnf := m.config.AppConfig.(*config.AppConfig)
+func init() {
+	exporter.Register("netgear", Factory)
+	exporter.RegisterCheck("netgear", Check)
 
-	if !utils.Member(cnf.Enabled, "icmp") {
-		return
-	}
+	// NSDP replies arrive on a fixed port.
+	exporter.RegisterSingle("netgear")
+}
 
-	exp := icmp.NewExporter(
-		m.appl.Context(),
-		m.appl.Logger(),
-		cnf.Icmp,
-	)
+func decodeConfig(inst *exporter.Instance) (*Config, error) {
+	cnf := NewDefaultConfig()
 
-	if err := exp.Setup(); err != nil {
-		panic(err.Error())
-	}
-	if err := exp.Scrape(); err != nil {
-		panic(err.Error())
+	// Report decoding problems along with anything else that is wrong.
+	err := errors.Join(exporter.Decode(inst.Config, cnf), Validate(cnf))
+	if err != nil {
+		return nil, err
 	}
-	m.config.Logger.Info(
-		"Initial scrape complete.",
-		"exporter", "icmp",
-	)
 
-	params := exporter.NewParams(
-		"icmp",
-		exp,
-		m.config.ProcessManager,
-		m.config.Logger,
-	)
+	return cnf, nil
+}
+
+func Check(inst *exporter.Instance) error {
+	_, err := decodeConfig(inst)
+
+	return err
+}
 
-	_, err := exporter.Spawn(params)
+func Factory(deps *exporter.Deps, inst *exporter.Instance) (exporter.IExporter, error) {
+	cnf, err := decodeConfig(inst)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
+
+	exp, err := NewExporter(deps.Context, deps.Logger, deps.Registerer, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	return exp, nil
 }
 
-/* icmp.go ends here. */
+/* factory.go ends here. */
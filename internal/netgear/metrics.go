@@ -30,119 +30,68 @@
 package netgear
 
 import (
+	"github.com/Asmodai/master-exporter/internal/metrics"
+
 	"github.com/prometheus/client_golang/prometheus"
 
 	"fmt"
 )
 
-type SwitchMetrics struct {
-	Metric map[string]prometheus.Gauge
+type Metrics struct {
+	Switch *metrics.Labelled
+	Port   *metrics.Labelled
 }
 
-func NewSwitchMetrics() *SwitchMetrics {
-	return &SwitchMetrics{
-		Metric: map[string]prometheus.Gauge{},
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		Switch: metrics.NewLabelled(reg, "netgear", "switch"),
+		Port:   metrics.NewLabelled(reg, "netgear", "switch", "port"),
 	}
-}
 
-func (sm *SwitchMetrics) AddMetric(name, help, pretty string) {
-	if sm.Metric == nil {
-		sm.Metric = map[string]prometheus.Gauge{}
-	}
+	m.Switch.Gauge("up", "Is the given switch online?")
 
-	if _, ok := sm.Metric[name]; !ok {
-		fmt.Printf("Adding metric %s{switch=\"%s\"}\n", name, pretty)
-		sm.Metric[name] = prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: "netgear",
-			Name:      name,
-			Help:      help,
-			ConstLabels: map[string]string{
-				"switch": pretty,
-			},
-		})
-		_ = prometheus.Register(sm.Metric[name])
-	}
-}
+	m.Port.Gauge("speed", "Port speed.")
+	m.Port.Gauge("rx_total_bytes", "Total bytes received for a port.")
+	m.Port.Gauge("tx_total_bytes", "Total bytes transmitted for a port.")
+	m.Port.Gauge("packets", "Total packets on this port.")
+	m.Port.Gauge("packets_bcast", "Total broadcast packets on this port.")
+	m.Port.Gauge("packets_mcast", "Total multicast packets on this port.")
+	m.Port.Gauge("crc_errors", "Total CRC errors on this port.")
 
-func (sm *SwitchMetrics) AddPortMetric(name, help, pretty string, port int) {
-	if sm.Metric == nil {
-		sm.Metric = map[string]prometheus.Gauge{}
+	if err := m.Switch.Err(); err != nil {
+		return nil, err
 	}
 
-	sport := fmt.Sprintf("%02d", port+1)
-
-	if _, ok := sm.Metric[name+sport]; !ok {
-		sm.Metric[name+sport] = prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: "netgear",
-			Name:      name,
-			Help:      help,
-			ConstLabels: map[string]string{
-				"port":   sport,
-				"switch": pretty,
-			},
-		})
-		_ = prometheus.Register(sm.Metric[name+sport])
-	}
-}
+	if err := m.Port.Err(); err != nil {
+		m.Switch.Unregister()
 
-func (sm *SwitchMetrics) SetMetric(name string, value uint64) {
-	if _, ok := sm.Metric[name]; !ok {
-		return
+		return nil, err
 	}
 
-	sm.Metric[name].Set(float64(value))
+	return m, nil
 }
 
-func (sm *SwitchMetrics) SetPortMetric(name string, port int, value uint64) {
-	sport := fmt.Sprintf("%02d", port+1)
-
-	if _, ok := sm.Metric[name+sport]; !ok {
-		return
-	}
-
-	sm.Metric[name+sport].Set(float64(value))
+func (m *Metrics) Switches() []string {
+	return m.Switch.Targets()
 }
 
-// =================================================================
-
-type Metrics struct {
-	metrics map[string]*SwitchMetrics
+func (m *Metrics) SetSwitch(name, sw string, value uint64) {
+	m.Switch.Set(name, float64(value), sw)
 }
 
-func NewMetrics() *Metrics {
-	return &Metrics{
-		metrics: map[string]*SwitchMetrics{},
-	}
-}
-
-func (m *Metrics) Keys() []string {
-	keys := []string{}
-
-	for k := range m.metrics {
-		keys = append(keys, k)
-	}
-
-	return keys
+func (m *Metrics) SetPort(name, sw string, port int, value uint64) {
+	m.Port.Set(name, float64(value), sw, fmt.Sprintf("%02d", port+1))
 }
 
-func (m *Metrics) HasSwitch(key string) bool {
-	_, ok := m.metrics[key]
-
-	return ok
-}
-
-func (m *Metrics) AddSwitch(key string) {
-	if _, ok := m.metrics[key]; ok {
-		return
-	}
-
-	m.metrics[key] = NewSwitchMetrics()
+// Delete every series for the given switch.
+func (m *Metrics) RemoveSwitch(sw string) {
+	m.Switch.Remove(sw)
+	m.Port.Remove(sw)
 }
 
-func (m *Metrics) GetSwitch(key string) *SwitchMetrics {
-	m.AddSwitch(key)
-
-	return m.metrics[key]
+func (m *Metrics) Unregister() {
+	m.Switch.Unregister()
+	m.Port.Unregister()
 }
 
 /* metrics.go ends here. */
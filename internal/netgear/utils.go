@@ -64,4 +64,22 @@ func GetInterfaceIPAddr(iface *net.Interface) (string, error) {
 	return "", fmt.Errorf("Could not locate unicast IP for '%s'", iface.Name)
 }
 
+// Return the first interface with a non-loopback IPv4 address, along
+// with that address.
+func GetSelf() (*net.Interface, string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for idx := range ifaces {
+		addr, err := GetInterfaceIPAddr(&ifaces[idx])
+		if err == nil {
+			return &ifaces[idx], addr, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("Could not locate a unicast IP address")
+}
+
 /* utils.go ends here. */
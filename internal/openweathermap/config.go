@@ -30,6 +30,11 @@
 package openweathermap
 
 import (
+	"github.com/Asmodai/master-exporter/internal/quota"
+	"github.com/Asmodai/master-exporter/internal/schedule"
+	"github.com/Asmodai/master-exporter/internal/secret"
+	"github.com/Asmodai/master-exporter/internal/validate"
+
 	"fmt"
 	"sync"
 )
@@ -37,14 +42,23 @@ import (
 type Config struct {
 	initUrl sync.Once
 
-	BaseUrl  string  `json:"base_url"`
-	Version  float32 `json:"version"`
-	Endpoint string  `json:"endpoint"`
-	Location string  `json:"location"`
-	Key      string  `json:"api_key"`
-	Units    string  `json:"units"`
-	Limit    int     `json:"limit"`
-	Interval int     `json:"interval"`
+	BaseUrl  string        `json:"base_url"`
+	Version  float32       `json:"version"`
+	Endpoint string        `json:"endpoint"`
+	Location string        `json:"location"`
+	Key      secret.String `json:"api_key"`
+	KeyFile  string        `json:"api_key_file"`
+	Units    string        `json:"units"`
+	Interval int           `json:"interval"`
+	Timeout  int           `json:"timeout"`
+
+	// Daily call limit, for when the quota does not give one.
+	Limit int           `json:"limit"`
+	Quota *quota.Config `json:"quota"`
+
+	// When to call the API.  The interval above is how often we check
+	// whether a call is due.
+	Schedule *schedule.Config `json:"schedule"`
 
 	urlCache string
 }
@@ -57,17 +71,57 @@ func NewDefaultConfig() *Config {
 		Location: "",
 		Key:      "",
 		Units:    "metric",
-		Limit:    1000,
 		Interval: 120,
+		Timeout:  10,
+		Limit:    1000,
+		Quota:    quota.NewDefaultConfig(),
+		Schedule: schedule.NewDefaultConfig(),
 	}
 }
 
-func Validate(cnf *Config) {
-	if cnf.Limit == 0 {
-		cnf.Limit = 1000
+// Check the configuration, returning every problem found.
+func Validate(cnf *Config) error {
+	if cnf == nil {
+		return fmt.Errorf("No configuration.")
+	}
+
+	c := validate.NewChecker()
+	c.URL("base_url", cnf.BaseUrl)
+	if cnf.KeyFile == "" {
+		c.Required("api_key", cnf.Key.Value())
 	}
+	c.Required("endpoint", cnf.Endpoint)
+	c.Required("location", cnf.Location)
+	c.OneOf("units", cnf.Units, "standard", "metric", "imperial")
+	c.Positive("limit", cnf.Limit)
+	c.Positive("interval", cnf.Interval)
+	c.Positive("timeout", cnf.Timeout)
+	c.Add(validate.Qualify("quota", quota.Validate(cnf.Quota)))
+	c.Add(validate.Qualify("schedule", schedule.Validate(cnf.Schedule)))
+
+	if cnf.Version <= 0 {
+		c.Fail("version", "must be positive")
+	}
+
+	return c.Err()
+}
+
+// Fall back on the call limit if the quota has no daily limit.
+func (c *Config) defaultQuota() {
+	if c.Quota != nil && c.Quota.PerDay == 0 {
+		c.Quota.PerDay = c.Limit
+	}
+}
+
+// Read the API key from its file, if one is given.
+func (c *Config) readKey() error {
+	return secret.Resolve(&c.Key, c.KeyFile, "api_key_file")
 }
 
+// Return the API URL.
+//
+// This contains the API key, so pass it through `secret.Redact` before
+// logging it.
 func (c *Config) GetURL() string {
 	c.initUrl.Do(func() {
 		c.urlCache = fmt.Sprintf(
@@ -77,7 +131,7 @@ func (c *Config) GetURL() string {
 			c.Endpoint,
 			c.Location,
 			c.Units,
-			c.Key,
+			c.Key.Value(),
 		)
 	})
 
@@ -30,83 +30,196 @@
 package openweathermap
 
 import (
-	//"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/quota"
+	"github.com/Asmodai/master-exporter/internal/schedule"
 
 	"github.com/Asmodai/gohacks/apiclient"
 	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
 type Exporter struct {
+	sync.Mutex
+
 	client  apiclient.IApiClient
 	logger  logger.ILogger
+	reg     prometheus.Registerer
 	config  *Config
 	data    *OpenWeatherMap
 	metrics *Metrics
-	calls   int
+	dropped bool
+	quota   *quota.Quota
+
+	// When the last call was made and the next is due, and how many
+	// calls in a row have returned the same observation.
+	schedule  *schedule.Schedule
+	called    time.Time
+	due       time.Time
+	observed  int64
+	unchanged int
 }
 
-func NewExporter(client apiclient.IApiClient, logger logger.ILogger, config *Config) *Exporter {
-	return &Exporter{
+func NewExporter(client apiclient.IApiClient, logger logger.ILogger, reg prometheus.Registerer, quota *quota.Quota, config *Config) (*Exporter, error) {
+	metrics, err := NewMetrics(reg, config.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Exporter{
 		client:  client,
 		logger:  logger,
+		reg:     reg,
 		config:  config,
 		data:    NewOpenWeatherMap(),
-		metrics: NewMetrics(config.Location),
-		calls:   0,
+		metrics: metrics,
+		quota:   quota,
+
+		schedule: schedule.New(config.Schedule),
 	}
+	e.restore()
+	e.metrics.SetInterval(float64(config.Interval))
+
+	return e, nil
 }
 
 func (e *Exporter) Data() *OpenWeatherMap {
 	return e.data
 }
 
-func (e *Exporter) canCall() bool { return e.calls < e.config.Limit }
+// Restore the calls saved by an earlier run.
+func (e *Exporter) restore() {
+	calls, err := e.quota.Restore()
+	if err != nil {
+		e.logger.Warn(
+			"Could not restore state.",
+			"exporter", "openweathermap",
+			"err", err.Error(),
+		)
+
+		return
+	}
 
-func (e *Exporter) resetLimit() {
+	if calls > 0 {
+		e.logger.Info(
+			"Restored call count.",
+			"exporter", "openweathermap",
+			"calls", calls,
+		)
+	}
+}
+
+// Charge a call against the quota, if it allows one.
+//
+// Calls are charged before they are made, as the provider will see them
+// even if we give up waiting for a response.
+func (e *Exporter) take() error {
 	now := time.Now()
 
-	if now.Hour() == 0 && now.Minute() == 0 {
-		if e.calls > 1 {
-			e.calls = 0
-		}
+	ok, err := e.quota.Take(now)
+	if !ok {
+		return exporter.NewError(exporter.ClassLimit, err)
 	}
+
+	if err != nil {
+		e.logger.Warn(
+			"Could not save state.",
+			"exporter", "openweathermap",
+			"err", err.Error(),
+		)
+	}
+
+	return nil
+}
+
+// Work out when the next call is due after a call made at `now`.
+//
+// An observation that has not moved on since the last call suggests we
+// are calling more often than the data changes, so we back off.
+func (e *Exporter) plan(now time.Time) {
+	if e.data.Timestamp == e.observed {
+		e.unchanged++
+	} else {
+		e.unchanged = 0
+		e.observed = e.data.Timestamp
+	}
+
+	e.called = now
+	e.reschedule(now)
 }
 
-func (e *Exporter) get() error {
-	e.resetLimit()
+// Work out when the next call is due from the time of the last one.
+//
+// The exported interval is the one that will actually be used.
+func (e *Exporter) reschedule(now time.Time) {
+	base := time.Duration(e.config.Interval) * time.Second
+	wait := e.schedule.Interval(now, base, e.quota.Pace(now), e.unchanged)
 
-	if !e.canCall() {
-		return fmt.Errorf("Daily call limit exceeded.")
+	// Skipping calls can only slow us down, so nothing shorter than the
+	// process interval can be honoured.
+	if wait < base {
+		e.logger.Debug(
+			"Schedule interval clamped to process interval.",
+			"exporter", "openweathermap",
+			"schedule", wait.String(),
+			"interval", base.String(),
+		)
+
+		wait = base
+	}
+
+	e.due = e.called.Add(wait)
+	e.metrics.SetInterval(wait.Seconds())
+}
+
+func (e *Exporter) get(ctx context.Context) error {
+	if err := e.take(); err != nil {
+		return err
 	}
 
 	params := &apiclient.Params{
 		Url: e.config.GetURL(),
 	}
 
-	data, code, err := e.client.Get(params)
+	data, code, err := exporter.Get(ctx, e.client, params)
 	if err != nil {
+		if code != 0 {
+			err = exporter.NewError(exporter.ClassHTTP, err)
+		}
+
 		return err
 	}
-	e.calls++
-
-	e.metrics.SetCalls(float64(e.calls))
-	e.metrics.SetLimit(float64(e.config.Limit))
 
 	switch code {
 	case 200:
 		{
-			err := json.Unmarshal(data, e.data)
+			// Decode into fresh data so a bad response can't leave
+			// us with a mixture of old and new values.
+			fresh := NewOpenWeatherMap()
+
+			err := json.Unmarshal(data, fresh)
 			if err != nil {
-				return fmt.Errorf("JSON unmarshal: %s", err)
+				return exporter.NewError(
+					exporter.ClassDecode,
+					fmt.Errorf("JSON unmarshal: %s", err),
+				)
 			}
+
+			e.data = fresh
 		}
 
 	default:
-		return fmt.Errorf("%d response: %s", code, err)
+		return exporter.NewError(
+			exporter.ClassHTTP,
+			fmt.Errorf("%d response: %s", code, err),
+		)
 	}
 
 	return nil
@@ -116,15 +229,46 @@ func (e *Exporter) Interval() int {
 	return e.config.Interval
 }
 
-func (e *Exporter) Scrape() error {
-	if err := e.get(); err != nil {
+func (e *Exporter) Timeout() int {
+	return e.config.Timeout
+}
+
+func (e *Exporter) Scrape(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+
+	// Allow a little slack, as our process will not wake up at exactly
+	// the moment the call falls due.
+	now := time.Now()
+	if e.due.Sub(now) > time.Second {
+		return fmt.Errorf(
+			"%w: next call due at %s",
+			exporter.ErrSkipped,
+			e.due.Format(time.RFC3339),
+		)
+	}
+
+	err := e.get(ctx)
+	if err != nil {
 		e.logger.Warn(
 			"Scrape error.",
 			"err", err.Error(),
 			"exporter", "openweathermap",
 		)
+
+		// Don't present old data as if it were new.
+		return err
 	}
 
+	if e.dropped {
+		if err := e.metrics.Register(); err != nil {
+			return err
+		}
+
+		e.dropped = false
+	}
+
+	e.plan(now)
 	e.metrics.SetTemp(float64(e.data.Main.Temperature))
 	e.metrics.SetTempFeelsLike(float64(e.data.Main.FeelsLike))
 	e.metrics.SetTempMin(float64(e.data.Main.TemperatureMin))
@@ -142,4 +286,68 @@ func (e *Exporter) Scrape() error {
 	return nil
 }
 
+// Apply a new configuration.
+//
+// The new configuration comes with a fresh URL cache, and the call count
+// is left alone.  The location is a label on every metric, so a change
+// of location requires the metrics to be recreated.
+func (e *Exporter) Reload(inst *exporter.Instance) error {
+	cnf, err := decodeConfig(inst)
+	if err != nil {
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	if cnf.Location != e.config.Location {
+		e.metrics.Unregister()
+
+		metrics, err := NewMetrics(e.reg, cnf.Location)
+		if err != nil {
+			if e.dropped {
+				return err
+			}
+
+			// Put the old metrics back and keep the old configuration.
+			return errors.Join(err, e.metrics.Register())
+		}
+
+		e.metrics = metrics
+		e.dropped = false
+	}
+
+	e.config = cnf
+	e.quota.SetConfig(cnf.Quota)
+	e.schedule = schedule.New(cnf.Schedule)
+
+	// The next call was planned under the old configuration.
+	if e.called.IsZero() {
+		e.metrics.SetInterval(float64(cnf.Interval))
+	} else {
+		e.reschedule(time.Now())
+	}
+
+	return nil
+}
+
+// Unregister the metrics until the next successful scrape.
+func (e *Exporter) Drop() {
+	e.Lock()
+	defer e.Unlock()
+
+	if !e.dropped {
+		e.metrics.Unregister()
+		e.dropped = true
+	}
+}
+
+func (e *Exporter) Close() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.metrics.Unregister()
+	e.quota.Close()
+}
+
 /* exporter.go ends here. */
@@ -0,0 +1,112 @@
+/*
+ * exporter_test.go --- OpenWeatherMap exporter tests.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package openweathermap
+
+import (
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/quota"
+
+	"github.com/Asmodai/gohacks/apiclient"
+	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func instance(interval int) *exporter.Instance {
+	return &exporter.Instance{
+		Type: "openweathermap",
+		Name: "openweathermap",
+		Config: json.RawMessage(fmt.Sprintf(`{
+			"base_url": "http://owm",
+			"version": 2.5,
+			"endpoint": "weather",
+			"location": "Here",
+			"api_key": "key",
+			"interval": %d
+		}`, interval)),
+	}
+}
+
+func newTestExporter(t *testing.T, inst *exporter.Instance) *Exporter {
+	t.Helper()
+
+	cnf, err := decodeConfig(inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := prometheus.NewRegistry()
+
+	q, err := quota.New("openweathermap", cnf.Quota, reg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := apiclient.NewMockClient(nil, nil)
+	client.GetFn = func(*apiclient.Params) ([]byte, int, error) {
+		return []byte(`{}`), 200, nil
+	}
+
+	e, err := NewExporter(client, logger.NewDefaultLogger(), reg, q, cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+
+	return e
+}
+
+func TestReloadReschedules(t *testing.T) {
+	e := newTestExporter(t, instance(600))
+
+	if err := e.Scrape(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if wait := e.due.Sub(e.called); wait != 600*time.Second {
+		t.Fatalf("next call after %s, want 10m0s", wait)
+	}
+
+	if err := e.Reload(instance(60)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The call planned under the old interval gives way to the new one.
+	if wait := e.due.Sub(e.called); wait != 60*time.Second {
+		t.Errorf("next call after %s, want 1m0s", wait)
+	}
+}
+
+/* exporter_test.go ends here. */
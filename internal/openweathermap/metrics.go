@@ -33,7 +33,6 @@ import (
 	"github.com/Asmodai/master-exporter/internal/metrics"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 type Metrics struct {
@@ -51,12 +50,13 @@ type Metrics struct {
 	Visibility    prometheus.Gauge
 	CloudCover    prometheus.Gauge
 
-	Calls prometheus.Gauge
-	Limit prometheus.Gauge
+	Interval prometheus.Gauge
+
+	group *metrics.Group
 }
 
-func NewGauge(name string, site string) prometheus.Gauge {
-	return promauto.NewGauge(prometheus.GaugeOpts{
+func NewGauge(group *metrics.Group, name, site string) prometheus.Gauge {
+	return group.Gauge(prometheus.GaugeOpts{
 		Namespace: "weather",
 		Name:      name,
 		Help:      "Weather data.",
@@ -66,25 +66,36 @@ func NewGauge(name string, site string) prometheus.Gauge {
 	})
 }
 
-func NewMetrics(site string) *Metrics {
-	return &Metrics{
-		Temp:          NewGauge("temp", site),
-		TempFeelsLike: NewGauge("temp_feels_like", site),
-		TempMax:       NewGauge("temp_max", site),
-		TempMin:       NewGauge("temp_min", site),
-		AirPressure:   NewGauge("air_pressure", site),
-		Humidity:      NewGauge("humidity", site),
-		RainLevel:     NewGauge("rain_level", site),
-		SnowLevel:     NewGauge("snow_level", site),
-		WindSpeed:     NewGauge("wind_speed", site),
-		WindGust:      NewGauge("wind_gust", site),
-		WindDirection: NewGauge("wind_direction", site),
-		Visibility:    NewGauge("visibility", site),
-		CloudCover:    NewGauge("cloud_cover", site),
-
-		Calls: metrics.NewMetricsGauge("calls", "weather"),
-		Limit: metrics.NewMetricsGauge("limit", "weather"),
+func NewMetrics(reg prometheus.Registerer, site string) (*Metrics, error) {
+	group := metrics.NewGroup(reg)
+
+	m := &Metrics{
+		Temp:          NewGauge(group, "temp", site),
+		TempFeelsLike: NewGauge(group, "temp_feels_like", site),
+		TempMax:       NewGauge(group, "temp_max", site),
+		TempMin:       NewGauge(group, "temp_min", site),
+		AirPressure:   NewGauge(group, "air_pressure", site),
+		Humidity:      NewGauge(group, "humidity", site),
+		RainLevel:     NewGauge(group, "rain_level", site),
+		SnowLevel:     NewGauge(group, "snow_level", site),
+		WindSpeed:     NewGauge(group, "wind_speed", site),
+		WindGust:      NewGauge(group, "wind_gust", site),
+		WindDirection: NewGauge(group, "wind_direction", site),
+		Visibility:    NewGauge(group, "visibility", site),
+		CloudCover:    NewGauge(group, "cloud_cover", site),
+
+		Interval: metrics.NewMetricsGauge(group, "interval_seconds", "weather"),
+
+		group: group,
+	}
+
+	if err := group.Err(); err != nil {
+		group.UnregisterAll()
+
+		return nil, err
 	}
+
+	return m, nil
 }
 
 func (m *Metrics) SetTemp(val float64)          { m.Temp.Set(val) }
@@ -101,7 +112,14 @@ func (m *Metrics) SetWindDirection(val float64) { m.WindDirection.Set(val) }
 func (m *Metrics) SetVisibility(val float64)    { m.Visibility.Set(val) }
 func (m *Metrics) SetCloudCover(val float64)    { m.CloudCover.Set(val) }
 
-func (m *Metrics) SetCalls(val float64) { m.Calls.Set(val) }
-func (m *Metrics) SetLimit(val float64) { m.Limit.Set(val) }
+func (m *Metrics) Register() error {
+	return m.group.RegisterAll()
+}
+
+func (m *Metrics) Unregister() {
+	m.group.UnregisterAll()
+}
+
+func (m *Metrics) SetInterval(val float64) { m.Interval.Set(val) }
 
 /* metrics.go ends here. */
@@ -0,0 +1,110 @@
+/*
+ * config.go --- Probe module configuration.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package probe
+
+import (
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"fmt"
+	"sort"
+)
+
+type Module struct {
+	Prober  string `json:"prober"`
+	Timeout int    `json:"timeout"`
+	Count   int    `json:"count"`
+	Size    int    `json:"size"`
+	TTL     int    `json:"ttl"`
+}
+
+type Config struct {
+	Modules map[string]*Module `json:"modules"`
+}
+
+func NewDefaultConfig() *Config {
+	return &Config{
+		Modules: map[string]*Module{
+			"icmp": {Prober: "icmp", Timeout: 5},
+			"dns":  {Prober: "dns", Timeout: 5},
+		},
+	}
+}
+
+// Fill in anything left unset and check the configuration, returning
+// every problem found.
+//
+// A module's prober defaults to the module's name.
+func Validate(cnf *Config) error {
+	if cnf == nil {
+		return fmt.Errorf("No configuration.")
+	}
+
+	if cnf.Modules == nil {
+		cnf.Modules = NewDefaultConfig().Modules
+	}
+
+	names := []string{}
+	for name := range cnf.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c := validate.NewChecker()
+	for _, name := range names {
+		path := "modules." + name
+
+		mod := cnf.Modules[name]
+		if mod == nil {
+			c.Fail(path, "no configuration")
+			continue
+		}
+
+		if mod.Prober == "" {
+			mod.Prober = name
+		}
+
+		if mod.Timeout == 0 {
+			mod.Timeout = 5
+		}
+
+		if _, ok := lookup(mod.Prober); !ok {
+			c.Fail(path+".prober", "unknown prober '%s'", mod.Prober)
+		}
+
+		c.Positive(path+".timeout", mod.Timeout)
+		c.AtLeast(path+".count", mod.Count, 0)
+		c.AtLeast(path+".size", mod.Size, 0)
+		c.AtLeast(path+".ttl", mod.TTL, 0)
+	}
+
+	return c.Err()
+}
+
+/* config.go ends here. */
@@ -0,0 +1,112 @@
+/*
+ * config_test.go --- Probe configuration tests.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package probe
+
+import (
+	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func init() {
+	nop := func(context.Context, *Module, string, prometheus.Registerer, logger.ILogger) error {
+		return nil
+	}
+
+	Register("icmp", nop)
+	Register("dns", nop)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   map[string]*Module
+		err    string
+	}{
+		{
+			name:   "defaults",
+			config: `{}`,
+			want:   NewDefaultConfig().Modules,
+		},
+		{
+			name:   "filled in",
+			config: `{"modules": {"dns": {}, "ping": {"prober": "icmp", "count": 2}}}`,
+			want: map[string]*Module{
+				"dns":  {Prober: "dns", Timeout: 5},
+				"ping": {Prober: "icmp", Timeout: 5, Count: 2},
+			},
+		},
+		{
+			name:   "null module",
+			config: `{"modules": {"foo": null}}`,
+			err:    "modules.foo: no configuration",
+		},
+		{
+			name:   "bad fields",
+			config: `{"modules": {"foo": {"timeout": -1, "ttl": -2}}}`,
+			err: "modules.foo.prober: unknown prober 'foo'\n" +
+				"modules.foo.timeout: must be positive\n" +
+				"modules.foo.ttl: must be at least 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cnf := &Config{}
+			if err := json.Unmarshal([]byte(tt.config), cnf); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Validate(cnf)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %s", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(cnf.Modules, tt.want) {
+				t.Errorf("modules = %+v, want %+v", cnf.Modules, tt.want)
+			}
+		})
+	}
+}
+
+/* config_test.go ends here. */
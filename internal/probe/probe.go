@@ -0,0 +1,201 @@
+/*
+ * probe.go --- On-demand probes.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package probe
+
+import (
+	"github.com/Asmodai/gohacks/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Probe a single target, registering any results with the registerer.
+//
+// Returns an error if the probe failed.
+type ProberFn func(context.Context, *Module, string, prometheus.Registerer, logger.ILogger) error
+
+var (
+	proberMu sync.RWMutex
+	probers  map[string]ProberFn = map[string]ProberFn{}
+)
+
+// Register a prober under the given name.
+//
+// This is intended to be called from an `init` function, and will panic
+// if the name is already taken.
+func Register(name string, fn ProberFn) {
+	proberMu.Lock()
+	defer proberMu.Unlock()
+
+	if _, dup := probers[name]; dup {
+		panic("probe: Register called twice for " + name)
+	}
+
+	probers[name] = fn
+}
+
+func lookup(name string) (ProberFn, bool) {
+	proberMu.RLock()
+	defer proberMu.RUnlock()
+
+	fn, ok := probers[name]
+
+	return fn, ok
+}
+
+// HTTP handler for `/probe?module=<module>&target=<target>`.
+//
+// Each request runs a single probe and returns its results from a fresh
+// registry, in the manner of the blackbox exporter.
+type Handler struct {
+	sync.RWMutex
+
+	config *Config
+	lgr    logger.ILogger
+}
+
+func NewHandler(cnf *Config, lgr logger.ILogger) *Handler {
+	h := &Handler{lgr: lgr}
+	h.SetConfig(cnf)
+
+	return h
+}
+
+// Replace the module configuration, e.g. after a reload.
+//
+// The configuration is expected to have been checked by `Validate`.
+func (h *Handler) SetConfig(cnf *Config) {
+	if cnf == nil {
+		cnf = NewDefaultConfig()
+	}
+
+	h.Lock()
+	h.config = cnf
+	h.Unlock()
+}
+
+func (h *Handler) module(name string) (*Module, bool) {
+	h.RLock()
+	defer h.RUnlock()
+
+	mod, ok := h.config.Modules[name]
+
+	return mod, ok && mod != nil
+}
+
+// Work out how long the probe may take.
+//
+// Prometheus tells us its scrape timeout, and we need to finish before
+// it gives up on us.
+func timeout(r *http.Request, mod *Module) time.Duration {
+	limit := time.Duration(mod.Timeout) * time.Second
+
+	hdr := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if secs, err := strconv.ParseFloat(hdr, 64); err == nil && secs > 0 {
+		// Leave a little headroom for the response itself.
+		scrape := time.Duration((secs - 0.5) * float64(time.Second))
+		if scrape > 0 && scrape < limit {
+			limit = scrape
+		}
+	}
+
+	return limit
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "Target parameter is missing.", http.StatusBadRequest)
+		return
+	}
+
+	name := params.Get("module")
+	mod, ok := h.module(name)
+	if !ok {
+		http.Error(
+			w,
+			fmt.Sprintf("Unknown module '%s'.", name),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	fn, ok := lookup(mod.Prober)
+	if !ok {
+		http.Error(
+			w,
+			fmt.Sprintf("Unknown prober '%s'.", mod.Prober),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout(r, mod))
+	defer cancel()
+
+	reg := prometheus.NewRegistry()
+	success := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "Did the probe succeed?",
+	})
+	duration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "How long the probe took. Seconds.",
+	})
+	reg.MustRegister(success, duration)
+
+	start := time.Now()
+	err := fn(ctx, mod, target, reg, h.lgr)
+	duration.Set(time.Since(start).Seconds())
+
+	if err != nil {
+		h.lgr.Debug(
+			"Probe failed.",
+			"module", name,
+			"target", target,
+			"err", err.Error(),
+		)
+	} else {
+		success.Set(1)
+	}
+
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+/* probe.go ends here. */
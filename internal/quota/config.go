@@ -0,0 +1,112 @@
+/*
+ * config.go --- API call quota configuration.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package quota
+
+import (
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"fmt"
+	"time"
+)
+
+const (
+	// The day runs from midnight to midnight in the quota's timezone.
+	WindowCalendar string = "calendar"
+
+	// The day is the 24 hours leading up to now.
+	WindowRolling string = "rolling"
+)
+
+type Config struct {
+	Window   string `json:"window"`
+	Timezone string `json:"timezone"`
+
+	// Limits on the number of calls; zero means no limit.
+	PerMinute int `json:"per_minute"`
+	PerDay    int `json:"per_day"`
+
+	// Spread the remaining daily budget evenly over the rest of the
+	// window rather than allowing calls whenever there is budget left.
+	Pace bool `json:"pace"`
+}
+
+func NewDefaultConfig() *Config {
+	return &Config{
+		Window:    WindowCalendar,
+		Timezone:  "",
+		PerMinute: 0,
+		PerDay:    0,
+		Pace:      false,
+	}
+}
+
+// Check the configuration, returning every problem found.
+func Validate(cnf *Config) error {
+	if cnf == nil {
+		return fmt.Errorf("No configuration.")
+	}
+
+	c := validate.NewChecker()
+	c.OneOf("window", cnf.Window, WindowCalendar, WindowRolling)
+	c.AtLeast("per_minute", cnf.PerMinute, 0)
+	c.AtLeast("per_day", cnf.PerDay, 0)
+
+	if _, err := loadLocation(cnf.Timezone); err != nil {
+		c.Fail("timezone", "unknown timezone '%s'", cnf.Timezone)
+	}
+
+	if cnf.Pace && cnf.PerDay == 0 {
+		c.Fail("pace", "requires per_day")
+	}
+
+	return c.Err()
+}
+
+// Return the timezone the quota's day is reckoned in.
+//
+// This is the local timezone unless one is given.
+func (c *Config) Location() *time.Location {
+	loc, err := loadLocation(c.Timezone)
+	if err != nil {
+		return time.Local
+	}
+
+	return loc
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+
+	return time.LoadLocation(name)
+}
+
+/* config.go ends here. */
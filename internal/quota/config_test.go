@@ -0,0 +1,64 @@
+/*
+ * config_test.go --- Tests for quota configuration.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package quota
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cnf     *Config
+		wantErr bool
+	}{
+		{"nil", nil, true},
+		{"default", NewDefaultConfig(), false},
+		{"rolling", &Config{Window: WindowRolling, PerDay: 100}, false},
+		{"timezone", &Config{Window: WindowCalendar, Timezone: "UTC"}, false},
+		{"bad window", &Config{Window: "weekly"}, true},
+		{"negative per_minute", &Config{Window: WindowCalendar, PerMinute: -1}, true},
+		{"negative per_day", &Config{Window: WindowCalendar, PerDay: -1}, true},
+		{"bad timezone", &Config{Window: WindowCalendar, Timezone: "Nowhere/Special"}, true},
+		{"pace without per_day", &Config{Window: WindowCalendar, Pace: true}, true},
+		{"pace", &Config{Window: WindowCalendar, PerDay: 10, Pace: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.cnf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+/* config_test.go ends here. */
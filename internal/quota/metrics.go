@@ -0,0 +1,107 @@
+/*
+ * metrics.go --- API call quota metrics.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package quota
+
+import (
+	"github.com/Asmodai/master-exporter/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"math"
+)
+
+type Metrics struct {
+	Calls           prometheus.Gauge
+	DailyLimit      prometheus.Gauge
+	DailyRemaining  prometheus.Gauge
+	MinuteLimit     prometheus.Gauge
+	MinuteRemaining prometheus.Gauge
+	Reset           prometheus.Gauge
+	Pace            prometheus.Gauge
+
+	group *metrics.Group
+}
+
+func NewGauge(group *metrics.Group, name, help, exporter string) prometheus.Gauge {
+	return group.Gauge(prometheus.GaugeOpts{
+		Namespace: "quota",
+		Name:      name,
+		Help:      help,
+		ConstLabels: map[string]string{
+			"exporter": exporter,
+		},
+	})
+}
+
+func NewMetrics(reg prometheus.Registerer, exporter string) (*Metrics, error) {
+	group := metrics.NewGroup(reg)
+
+	m := &Metrics{
+		Calls: NewGauge(group, "calls",
+			"Calls made in the current daily window.", exporter),
+		DailyLimit: NewGauge(group, "daily_limit",
+			"Calls allowed per daily window.", exporter),
+		DailyRemaining: NewGauge(group, "daily_remaining",
+			"Calls left in the current daily window.", exporter),
+		MinuteLimit: NewGauge(group, "minute_limit",
+			"Calls allowed per minute.", exporter),
+		MinuteRemaining: NewGauge(group, "minute_remaining",
+			"Calls left in the current minute.", exporter),
+		Reset: NewGauge(group, "reset_timestamp_seconds",
+			"When more daily calls next become available.", exporter),
+		Pace: NewGauge(group, "pace_seconds",
+			"Time between calls that spreads the remaining daily calls over the window.", exporter),
+
+		group: group,
+	}
+
+	if err := group.Err(); err != nil {
+		group.UnregisterAll()
+
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *Metrics) Unregister() {
+	m.group.UnregisterAll()
+}
+
+// Return a limit as a metric value, where no limit is infinite.
+func limit(val int) float64 {
+	if val <= 0 {
+		return math.Inf(1)
+	}
+
+	return float64(val)
+}
+
+/* metrics.go ends here. */
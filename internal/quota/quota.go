@@ -0,0 +1,374 @@
+/*
+ * quota.go --- API call quota.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package quota
+
+import (
+	"github.com/Asmodai/master-exporter/internal/state"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Calls are counted per minute, and a day's worth of minutes are kept.
+// An hour more is kept for days lengthened by a clock change.
+const keep = 25 * 60
+
+type bucket struct {
+	Minute int64 `json:"minute"`
+	Calls  int   `json:"calls"`
+}
+
+// What is kept across restarts, so that a restart does not reset the
+// quota.
+type persisted struct {
+	Buckets []bucket  `json:"buckets"`
+	Last    time.Time `json:"last_call"`
+}
+
+// Tracks calls made against an API's quota.
+//
+// Calls are counted in one-minute buckets, from which the calls in the
+// current minute and the current daily window are worked out.  The
+// buckets are saved after every call, so a restart carries on where it
+// left off rather than starting with a fresh budget.
+type Quota struct {
+	sync.Mutex
+
+	cnf     *Config
+	loc     *time.Location
+	buckets []bucket
+	last    time.Time
+	state   *state.Entry
+	metrics *Metrics
+}
+
+func New(name string, cnf *Config, reg prometheus.Registerer, entry *state.Entry) (*Quota, error) {
+	metrics, err := NewMetrics(reg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Quota{
+		buckets: []bucket{},
+		state:   entry,
+		metrics: metrics,
+	}
+	q.SetConfig(cnf)
+
+	return q, nil
+}
+
+// Apply a new configuration, keeping the calls made so far.
+func (q *Quota) SetConfig(cnf *Config) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.cnf = cnf
+	q.loc = cnf.Location()
+	q.update(time.Now())
+}
+
+// Restore the calls saved by an earlier run.
+//
+// Returns the number of calls restored into the current window.
+func (q *Quota) Restore() (int, error) {
+	st := &persisted{}
+
+	ok, err := q.state.Load(st)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	now := time.Now()
+	q.buckets = st.Buckets
+	q.last = st.Last
+	q.prune(now)
+	q.update(now)
+
+	return q.used(now), nil
+}
+
+// Check whether a call may be made now.
+//
+// The error describes which limit would be exceeded.
+func (q *Quota) Allow(now time.Time) error {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.allow(now)
+}
+
+// Count a call made at the given time, and save the quota.
+func (q *Quota) Record(now time.Time) error {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.record(now)
+}
+
+// Charge a call against the quota if one may be made now.
+//
+// This is done before the call is made, so that a call the provider sees
+// is always counted, and two callers cannot both take the last one.
+//
+// Returns whether the call was charged.  If it was not, the error says
+// why; if it was, the error is from saving the quota.
+func (q *Quota) Take(now time.Time) (bool, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	if err := q.allow(now); err != nil {
+		return false, err
+	}
+
+	return true, q.record(now)
+}
+
+// Return the calls made in the current daily window.
+func (q *Quota) Used(now time.Time) int {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.used(now)
+}
+
+// Return the calls left in the current daily window, or -1 if there is
+// no daily limit.
+func (q *Quota) Remaining(now time.Time) int {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.remaining(now)
+}
+
+// Return when more daily calls next become available.
+func (q *Quota) ResetAt(now time.Time) time.Time {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.resetAt(now)
+}
+
+// Return the time between calls that would spread the remaining daily
+// calls evenly over the rest of the window, or zero if there is no
+// daily limit.
+func (q *Quota) Pace(now time.Time) time.Duration {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.pace(now)
+}
+
+func (q *Quota) Close() {
+	q.metrics.Unregister()
+}
+
+func (q *Quota) allow(now time.Time) error {
+	q.update(now)
+
+	if q.cnf.PerDay > 0 && q.used(now) >= q.cnf.PerDay {
+		return fmt.Errorf(
+			"Daily quota of %d calls used; resets at %s.",
+			q.cnf.PerDay,
+			q.resetAt(now).Format(time.RFC3339),
+		)
+	}
+
+	if q.cnf.PerMinute > 0 && q.thisMinute(now) >= q.cnf.PerMinute {
+		return fmt.Errorf(
+			"Quota of %d calls per minute used.",
+			q.cnf.PerMinute,
+		)
+	}
+
+	if wait := q.pace(now) - now.Sub(q.last); q.cnf.Pace && wait > 0 {
+		return fmt.Errorf(
+			"Pacing calls; next call allowed in %s.",
+			wait.Round(time.Second),
+		)
+	}
+
+	return nil
+}
+
+func (q *Quota) record(now time.Time) error {
+	minute := now.Unix() / 60
+	if n := len(q.buckets); n > 0 && q.buckets[n-1].Minute == minute {
+		q.buckets[n-1].Calls++
+	} else {
+		q.buckets = append(q.buckets, bucket{Minute: minute, Calls: 1})
+	}
+
+	if now.After(q.last) {
+		q.last = now
+	}
+
+	q.prune(now)
+	q.update(now)
+
+	return q.state.Save(&persisted{
+		Buckets: q.buckets,
+		Last:    q.last,
+	})
+}
+
+// Return the start of the daily window.
+func (q *Quota) start(now time.Time) time.Time {
+	if q.cnf.Window == WindowRolling {
+		return now.Add(-24 * time.Hour)
+	}
+
+	y, m, d := now.In(q.loc).Date()
+
+	return time.Date(y, m, d, 0, 0, 0, 0, q.loc)
+}
+
+// Does the bucket hold calls made in the daily window?
+//
+// A bucket that straddles the start of the window counts, so we err on
+// the side of caution.
+func (q *Quota) within(b bucket, start time.Time) bool {
+	return (b.Minute+1)*60 > start.Unix()
+}
+
+func (q *Quota) used(now time.Time) int {
+	start := q.start(now)
+	used := 0
+
+	for _, b := range q.buckets {
+		if q.within(b, start) {
+			used += b.Calls
+		}
+	}
+
+	return used
+}
+
+func (q *Quota) remaining(now time.Time) int {
+	if q.cnf.PerDay <= 0 {
+		return -1
+	}
+
+	if used := q.used(now); used < q.cnf.PerDay {
+		return q.cnf.PerDay - used
+	}
+
+	return 0
+}
+
+func (q *Quota) thisMinute(now time.Time) int {
+	minute := now.Unix() / 60
+
+	for _, b := range q.buckets {
+		if b.Minute == minute {
+			return b.Calls
+		}
+	}
+
+	return 0
+}
+
+func (q *Quota) resetAt(now time.Time) time.Time {
+	if q.cnf.Window != WindowRolling {
+		y, m, d := now.In(q.loc).Date()
+
+		return time.Date(y, m, d+1, 0, 0, 0, 0, q.loc)
+	}
+
+	// The oldest calls in the window are the next to fall out of it.
+	start := q.start(now)
+	for _, b := range q.buckets {
+		if q.within(b, start) {
+			return time.Unix((b.Minute+1)*60, 0).Add(24 * time.Hour)
+		}
+	}
+
+	return now
+}
+
+func (q *Quota) pace(now time.Time) time.Duration {
+	if q.cnf.PerDay <= 0 {
+		return 0
+	}
+
+	if q.cnf.Window == WindowRolling {
+		return 24 * time.Hour / time.Duration(q.cnf.PerDay)
+	}
+
+	left := q.resetAt(now).Sub(now)
+	if remaining := q.remaining(now); remaining > 0 {
+		return left / time.Duration(remaining)
+	}
+
+	return left
+}
+
+// Forget buckets too old to matter.
+func (q *Quota) prune(now time.Time) {
+	oldest := now.Unix()/60 - keep
+	kept := q.buckets[:0]
+
+	for _, b := range q.buckets {
+		if b.Minute > oldest {
+			kept = append(kept, b)
+		}
+	}
+
+	q.buckets = kept
+}
+
+func (q *Quota) update(now time.Time) {
+	minute := math.Inf(1)
+	if q.cnf.PerMinute > 0 {
+		minute = math.Max(float64(q.cnf.PerMinute-q.thisMinute(now)), 0)
+	}
+
+	daily := math.Inf(1)
+	if remaining := q.remaining(now); remaining >= 0 {
+		daily = float64(remaining)
+	}
+
+	q.metrics.Calls.Set(float64(q.used(now)))
+	q.metrics.DailyLimit.Set(limit(q.cnf.PerDay))
+	q.metrics.DailyRemaining.Set(daily)
+	q.metrics.MinuteLimit.Set(limit(q.cnf.PerMinute))
+	q.metrics.MinuteRemaining.Set(minute)
+	q.metrics.Reset.Set(float64(q.resetAt(now).Unix()))
+	q.metrics.Pace.Set(q.pace(now).Seconds())
+}
+
+/* quota.go ends here. */
@@ -0,0 +1,343 @@
+/*
+ * quota_test.go --- Tests for API quotas.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package quota
+
+import (
+	"github.com/Asmodai/master-exporter/internal/state"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func newQuota(t *testing.T, cnf *Config, entry *state.Entry) *Quota {
+	t.Helper()
+
+	q, err := New("test", cnf, prometheus.NewRegistry(), entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q
+}
+
+func at(value string) time.Time {
+	when, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+
+	return when
+}
+
+func TestAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		cnf     *Config
+		calls   []string
+		now     string
+		wantErr bool
+	}{
+		{
+			name:  "unlimited",
+			cnf:   &Config{Window: WindowCalendar, Timezone: "UTC"},
+			calls: []string{"2024-05-01T10:00:00Z", "2024-05-01T10:00:01Z"},
+			now:   "2024-05-01T10:00:02Z",
+		},
+		{
+			name:    "daily used",
+			cnf:     &Config{Window: WindowCalendar, Timezone: "UTC", PerDay: 2},
+			calls:   []string{"2024-05-01T01:00:00Z", "2024-05-01T09:00:00Z"},
+			now:     "2024-05-01T23:59:00Z",
+			wantErr: true,
+		},
+		{
+			name:  "daily reset at midnight",
+			cnf:   &Config{Window: WindowCalendar, Timezone: "UTC", PerDay: 2},
+			calls: []string{"2024-05-01T01:00:00Z", "2024-05-01T09:00:00Z"},
+			now:   "2024-05-02T00:00:00Z",
+		},
+		{
+			name:    "daily in timezone",
+			cnf:     &Config{Window: WindowCalendar, Timezone: "Asia/Tokyo", PerDay: 1},
+			calls:   []string{"2024-05-01T15:30:00Z"},
+			now:     "2024-05-01T16:00:00Z",
+			wantErr: true,
+		},
+		{
+			name:  "daily reset in timezone",
+			cnf:   &Config{Window: WindowCalendar, Timezone: "Asia/Tokyo", PerDay: 1},
+			calls: []string{"2024-05-01T14:30:00Z"},
+			now:   "2024-05-01T15:00:00Z",
+		},
+		{
+			name:    "rolling used",
+			cnf:     &Config{Window: WindowRolling, PerDay: 1},
+			calls:   []string{"2024-05-01T10:00:00Z"},
+			now:     "2024-05-02T09:58:00Z",
+			wantErr: true,
+		},
+		{
+			name:  "rolling expired",
+			cnf:   &Config{Window: WindowRolling, PerDay: 1},
+			calls: []string{"2024-05-01T10:00:00Z"},
+			now:   "2024-05-02T10:01:00Z",
+		},
+		{
+			name:    "minute used",
+			cnf:     &Config{Window: WindowCalendar, Timezone: "UTC", PerMinute: 2},
+			calls:   []string{"2024-05-01T10:00:01Z", "2024-05-01T10:00:30Z"},
+			now:     "2024-05-01T10:00:59Z",
+			wantErr: true,
+		},
+		{
+			name:  "next minute",
+			cnf:   &Config{Window: WindowCalendar, Timezone: "UTC", PerMinute: 2},
+			calls: []string{"2024-05-01T10:00:01Z", "2024-05-01T10:00:30Z"},
+			now:   "2024-05-01T10:01:00Z",
+		},
+		{
+			name:    "paced too soon",
+			cnf:     &Config{Window: WindowCalendar, Timezone: "UTC", PerDay: 24, Pace: true},
+			calls:   []string{"2024-05-01T00:00:00Z"},
+			now:     "2024-05-01T00:30:00Z",
+			wantErr: true,
+		},
+		{
+			name:  "paced",
+			cnf:   &Config{Window: WindowCalendar, Timezone: "UTC", PerDay: 24, Pace: true},
+			calls: []string{"2024-05-01T00:00:00Z"},
+			now:   "2024-05-01T01:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newQuota(t, tt.cnf, nil)
+
+			for _, call := range tt.calls {
+				if err := q.Record(at(call)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := q.Allow(at(tt.now))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Allow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTake(t *testing.T) {
+	q := newQuota(t, &Config{Window: WindowCalendar, Timezone: "UTC", PerDay: 2}, nil)
+	now := at("2024-05-01T10:00:00Z")
+
+	tests := []struct {
+		want bool
+		used int
+	}{
+		{true, 1},
+		{true, 2},
+		{false, 2},
+		{false, 2},
+	}
+
+	for idx, tt := range tests {
+		ok, err := q.Take(now)
+		if ok != tt.want {
+			t.Errorf("call %d: Take() = %v, want %v (%v)", idx, ok, tt.want, err)
+		}
+
+		if ok && err != nil {
+			t.Errorf("call %d: unexpected error %v", idx, err)
+		}
+
+		if used := q.Used(now); used != tt.used {
+			t.Errorf("call %d: Used() = %d, want %d", idx, used, tt.used)
+		}
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	tests := []struct {
+		name  string
+		cnf   *Config
+		calls int
+		want  int
+	}{
+		{"unlimited", &Config{Window: WindowCalendar, Timezone: "UTC"}, 3, -1},
+		{"some left", &Config{Window: WindowCalendar, Timezone: "UTC", PerDay: 5}, 3, 2},
+		{"none left", &Config{Window: WindowCalendar, Timezone: "UTC", PerDay: 3}, 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newQuota(t, tt.cnf, nil)
+			now := at("2024-05-01T10:00:00Z")
+
+			for i := 0; i < tt.calls; i++ {
+				if err := q.Record(now); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := q.Remaining(now); got != tt.want {
+				t.Errorf("Remaining() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResetAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		cnf   *Config
+		calls []string
+		now   string
+		want  string
+	}{
+		{
+			name: "calendar",
+			cnf:  &Config{Window: WindowCalendar, Timezone: "UTC"},
+			now:  "2024-05-01T10:00:00Z",
+			want: "2024-05-02T00:00:00Z",
+		},
+		{
+			name: "calendar in timezone",
+			cnf:  &Config{Window: WindowCalendar, Timezone: "Asia/Tokyo"},
+			now:  "2024-05-01T10:00:00Z",
+			want: "2024-05-01T15:00:00Z",
+		},
+		{
+			name:  "rolling",
+			cnf:   &Config{Window: WindowRolling, PerDay: 10},
+			calls: []string{"2024-05-01T09:00:30Z", "2024-05-01T09:30:00Z"},
+			now:   "2024-05-01T10:00:00Z",
+			want:  "2024-05-02T09:01:00Z",
+		},
+		{
+			name: "rolling and empty",
+			cnf:  &Config{Window: WindowRolling, PerDay: 10},
+			now:  "2024-05-01T10:00:00Z",
+			want: "2024-05-01T10:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newQuota(t, tt.cnf, nil)
+
+			for _, call := range tt.calls {
+				if err := q.Record(at(call)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := q.ResetAt(at(tt.now)); !got.Equal(at(tt.want)) {
+				t.Errorf("ResetAt() = %s, want %s", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPace(t *testing.T) {
+	tests := []struct {
+		name  string
+		cnf   *Config
+		calls int
+		now   string
+		want  time.Duration
+	}{
+		{"unlimited", &Config{Window: WindowCalendar, Timezone: "UTC"}, 0, "2024-05-01T00:00:00Z", 0},
+		{"calendar", &Config{Window: WindowCalendar, Timezone: "UTC", PerDay: 24}, 0, "2024-05-01T00:00:00Z", time.Hour},
+		{"calendar half used", &Config{Window: WindowCalendar, Timezone: "UTC", PerDay: 24}, 12, "2024-05-01T12:00:00Z", time.Hour},
+		{"calendar used", &Config{Window: WindowCalendar, Timezone: "UTC", PerDay: 2}, 2, "2024-05-01T12:00:00Z", 12 * time.Hour},
+		{"rolling", &Config{Window: WindowRolling, PerDay: 48}, 0, "2024-05-01T12:00:00Z", 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newQuota(t, tt.cnf, nil)
+			now := at(tt.now)
+
+			for i := 0; i < tt.calls; i++ {
+				if err := q.Record(now); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := q.Pace(now); got != tt.want {
+				t.Errorf("Pace() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	store, err := state.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := &Config{Window: WindowRolling, PerDay: 10}
+	now := time.Now()
+
+	first := newQuota(t, cnf, store.Entry("test"))
+	for i := 0; i < 3; i++ {
+		if err := first.Record(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	second := newQuota(t, cnf, store.Entry("test"))
+	calls, err := second.Restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 3 {
+		t.Errorf("Restore() = %d, want 3", calls)
+	}
+
+	if used := second.Used(now); used != 3 {
+		t.Errorf("Used() = %d, want 3", used)
+	}
+
+	// Nothing saved is nothing restored.
+	fresh := newQuota(t, cnf, store.Entry("other"))
+	if calls, err := fresh.Restore(); calls != 0 || err != nil {
+		t.Errorf("Restore() = %d, %v; want 0, nil", calls, err)
+	}
+}
+
+/* quota_test.go ends here. */
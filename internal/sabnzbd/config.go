@@ -30,6 +30,10 @@
 package sabnzbd
 
 import (
+	"github.com/Asmodai/master-exporter/internal/quota"
+	"github.com/Asmodai/master-exporter/internal/secret"
+	"github.com/Asmodai/master-exporter/internal/validate"
+
 	"fmt"
 	"sync"
 )
@@ -37,9 +41,12 @@ import (
 type Config struct {
 	initUrl sync.Once
 
-	BaseUrl  string `json:"base_url"`
-	Key      string `json:"api_key"`
-	Interval int    `json:"interval"`
+	BaseUrl  string        `json:"base_url"`
+	Key      secret.String `json:"api_key"`
+	KeyFile  string        `json:"api_key_file"`
+	Interval int           `json:"interval"`
+	Timeout  int           `json:"timeout"`
+	Quota    *quota.Config `json:"quota"`
 
 	urlCache string
 }
@@ -49,18 +56,44 @@ func NewDefaultConfig() *Config {
 		BaseUrl:  "",
 		Key:      "",
 		Interval: 10,
+		Timeout:  5,
+		Quota:    quota.NewDefaultConfig(),
+	}
+}
+
+// Check the configuration, returning every problem found.
+func Validate(cnf *Config) error {
+	if cnf == nil {
+		return fmt.Errorf("No configuration.")
 	}
+
+	c := validate.NewChecker()
+	c.URL("base_url", cnf.BaseUrl)
+	if cnf.KeyFile == "" {
+		c.Required("api_key", cnf.Key.Value())
+	}
+	c.Positive("interval", cnf.Interval)
+	c.Positive("timeout", cnf.Timeout)
+	c.Add(validate.Qualify("quota", quota.Validate(cnf.Quota)))
+
+	return c.Err()
 }
 
-func Validate(*Config) {
+// Read the API key from its file, if one is given.
+func (c *Config) readKey() error {
+	return secret.Resolve(&c.Key, c.KeyFile, "api_key_file")
 }
 
+// Return the API URL.
+//
+// This contains the API key, so pass it through `secret.Redact` before
+// logging it.
 func (c *Config) GetURL() string {
 	c.initUrl.Do(func() {
 		c.urlCache = fmt.Sprintf(
 			"%s/api?output=json&apikey=%s",
 			c.BaseUrl,
-			c.Key,
+			c.Key.Value(),
 		)
 	})
 
@@ -30,77 +30,125 @@
 package sabnzbd
 
 import (
-	//"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/quota"
 
 	"github.com/Asmodai/gohacks/apiclient"
 	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
 type Exporter struct {
+	sync.Mutex
+
 	client  apiclient.IApiClient
 	logger  logger.ILogger
 	config  *Config
 	data    *SabNZBd
 	metrics *Metrics
-	calls   int
+	dropped bool
+	quota   *quota.Quota
 }
 
-func NewExporter(client apiclient.IApiClient, logger logger.ILogger, config *Config) *Exporter {
-	return &Exporter{
+func NewExporter(client apiclient.IApiClient, logger logger.ILogger, reg prometheus.Registerer, quota *quota.Quota, config *Config) (*Exporter, error) {
+	metrics, err := NewMetrics(reg)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Exporter{
 		client:  client,
 		logger:  logger,
 		config:  config,
 		data:    NewSabNZBd(),
-		metrics: NewMetrics(),
-		calls:   0,
+		metrics: metrics,
+		quota:   quota,
 	}
+	e.restore()
+
+	return e, nil
 }
 
 func (e *Exporter) Data() *SabNZBd {
 	return e.data
 }
 
-func (e *Exporter) canCall() bool { return true }
+// Restore the calls saved by an earlier run.
+func (e *Exporter) restore() {
+	calls, err := e.quota.Restore()
+	if err != nil {
+		e.logger.Warn(
+			"Could not restore state.",
+			"exporter", "sabnzbd",
+			"err", err.Error(),
+		)
 
-func (e *Exporter) resetLimit() {
-	now := time.Now()
+		return
+	}
 
-	if now.Hour() == 0 && now.Minute() == 0 {
-		if e.calls > 1 {
-			e.calls = 0
-		}
+	if calls > 0 {
+		e.logger.Info(
+			"Restored call count.",
+			"exporter", "sabnzbd",
+			"calls", calls,
+		)
 	}
 }
 
-func (e *Exporter) get(mode string) ([]byte, error) {
-	e.resetLimit()
+// Charge a scrape against the quota, if it allows one.
+//
+// A scrape makes more than one request, but is charged as one call so
+// that pacing spaces out scrapes rather than the requests within them.
+// Calls are charged before they are made, as the provider will see them
+// even if we give up waiting for a response.
+func (e *Exporter) take() error {
+	now := time.Now()
+
+	ok, err := e.quota.Take(now)
+	if !ok {
+		return exporter.NewError(exporter.ClassLimit, err)
+	}
 
-	if !e.canCall() {
-		return []byte{}, fmt.Errorf("Daily call limit exceeded.")
+	if err != nil {
+		e.logger.Warn(
+			"Could not save state.",
+			"exporter", "sabnzbd",
+			"err", err.Error(),
+		)
 	}
 
+	return nil
+}
+
+func (e *Exporter) get(ctx context.Context, mode string) ([]byte, error) {
 	params := &apiclient.Params{
 		Url: fmt.Sprintf("%s&mode=%s", e.config.GetURL(), mode),
 	}
 
-	data, code, err := e.client.Get(params)
+	data, code, err := exporter.Get(ctx, e.client, params)
 	if err != nil {
+		if code != 0 {
+			err = exporter.NewError(exporter.ClassHTTP, err)
+		}
+
 		return []byte{}, err
 	}
-	e.calls++
-
-	e.metrics.SetCalls(float64(e.calls))
-	e.metrics.SetLimit(float64(35000.0))
 
 	switch code {
 	case 200:
 		return data, nil
 	default:
-		return []byte{}, fmt.Errorf("%d response: %s", code, err)
+		return []byte{}, exporter.NewError(
+			exporter.ClassHTTP,
+			fmt.Errorf("%d response: %s", code, err),
+		)
 	}
 }
 
@@ -108,33 +156,68 @@ func (e *Exporter) Interval() int {
 	return e.config.Interval
 }
 
-func (e *Exporter) Scrape() error {
-	queue, err := e.get(modeQueue)
+func (e *Exporter) Timeout() int {
+	return e.config.Timeout
+}
+
+func (e *Exporter) Scrape(ctx context.Context) error {
+	e.Lock()
+	defer e.Unlock()
+
+	if err := e.take(); err != nil {
+		return err
+	}
+
+	queue, err := e.get(ctx, modeQueue)
 	if err != nil {
 		e.logger.Warn(
 			"Scrape error.",
 			"err", err.Error(),
 			"exporter", "sabnzbd",
 		)
+
+		return err
 	}
 
-	server, err := e.get(modeServer)
+	server, err := e.get(ctx, modeServer)
 	if err != nil {
 		e.logger.Warn(
 			"Scrape error.",
 			"err", err.Error(),
 			"exporter", "sabnzbd",
 		)
+
+		return err
 	}
 
-	err = json.Unmarshal(queue, e.data.Queue)
+	// Decode into fresh data so a bad response can't leave us with a
+	// mixture of old and new values.
+	fresh := NewSabNZBd()
+
+	err = json.Unmarshal(queue, fresh.Queue)
 	if err != nil {
-		return fmt.Errorf("JSON unmarshal: %s", err)
+		return exporter.NewError(
+			exporter.ClassDecode,
+			fmt.Errorf("JSON unmarshal: %s", err),
+		)
 	}
 
-	err = json.Unmarshal(server, e.data.Server)
+	err = json.Unmarshal(server, fresh.Server)
 	if err != nil {
-		return fmt.Errorf("JSON unmarshal: %s", err)
+		return exporter.NewError(
+			exporter.ClassDecode,
+			fmt.Errorf("JSON unmarshal: %s", err),
+		)
+	}
+
+	e.data = fresh
+
+	if e.dropped {
+		if err := e.metrics.Register(); err != nil {
+			return err
+		}
+
+		e.dropped = false
 	}
 
 	e.metrics.SetSpeedLimit(e.data.Queue.Queue.SpeedLimit.Float64())
@@ -150,11 +233,51 @@ func (e *Exporter) Scrape() error {
 	e.metrics.SetSlotTotal(float64(e.data.Queue.Queue.NoOfSlotsTotal))
 
 	e.metrics.SetXferTotal(float64(e.data.Server.Total))
+
+	errs := []error{}
 	for k := range e.data.Server.Servers {
-		e.metrics.SetServerXfer(k, float64(e.data.Server.Servers[k].Total))
+		errs = append(errs, e.metrics.SetServerXfer(k, float64(e.data.Server.Servers[k].Total)))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Apply a new configuration.
+//
+// The new configuration comes with a fresh URL cache, and the call count
+// is left alone.
+func (e *Exporter) Reload(inst *exporter.Instance) error {
+	cnf, err := decodeConfig(inst)
+	if err != nil {
+		return err
 	}
 
+	e.Lock()
+	defer e.Unlock()
+
+	e.config = cnf
+	e.quota.SetConfig(cnf.Quota)
+
 	return nil
 }
 
+// Unregister the metrics until the next successful scrape.
+func (e *Exporter) Drop() {
+	e.Lock()
+	defer e.Unlock()
+
+	if !e.dropped {
+		e.metrics.Unregister()
+		e.dropped = true
+	}
+}
+
+func (e *Exporter) Close() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.metrics.Unregister()
+	e.quota.Close()
+}
+
 /* exporter.go ends here. */
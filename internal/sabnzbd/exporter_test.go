@@ -0,0 +1,144 @@
+/*
+ * exporter_test.go --- SABnzbd exporter tests.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package sabnzbd
+
+import (
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/quota"
+
+	"github.com/Asmodai/gohacks/apiclient"
+	"github.com/Asmodai/gohacks/logger"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"context"
+	"strings"
+	"testing"
+)
+
+func newTestExporter(t *testing.T, cnf *Config, client apiclient.IApiClient) *Exporter {
+	t.Helper()
+
+	reg := prometheus.NewRegistry()
+
+	q, err := quota.New("sabnzbd", cnf.Quota, reg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewExporter(client, logger.NewDefaultLogger(), reg, q, cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+
+	return e
+}
+
+func TestScrapeQuota(t *testing.T) {
+	tests := []struct {
+		name  string
+		quota *quota.Config
+		want  []string // Class of each scrape's error; "" for none.
+	}{
+		{
+			name:  "no limit",
+			quota: quota.NewDefaultConfig(),
+			want:  []string{"", ""},
+		},
+		{
+			name: "paced",
+			quota: &quota.Config{
+				Window: quota.WindowRolling,
+				PerDay: 100,
+				Pace:   true,
+			},
+			want: []string{"", exporter.ClassLimit},
+		},
+		{
+			name: "per minute",
+			quota: &quota.Config{
+				Window:    quota.WindowCalendar,
+				PerMinute: 1,
+			},
+			want: []string{"", exporter.ClassLimit},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := []string{}
+
+			client := apiclient.NewMockClient(nil, nil)
+			client.GetFn = func(params *apiclient.Params) ([]byte, int, error) {
+				requests = append(requests, params.Url)
+
+				return []byte(`{}`), 200, nil
+			}
+
+			cnf := NewDefaultConfig()
+			cnf.BaseUrl = "http://sabnzbd"
+			cnf.Key = "key"
+			cnf.Quota = tt.quota
+
+			e := newTestExporter(t, cnf, client)
+
+			for idx, class := range tt.want {
+				got := ""
+				if err := e.Scrape(context.Background()); err != nil {
+					got = exporter.Classify(err)
+				}
+
+				if got != class {
+					t.Fatalf("scrape %d: class = %q, want %q", idx, got, class)
+				}
+			}
+
+			// Refused scrapes make no requests at all.
+			calls := 0
+			for _, class := range tt.want {
+				if class == "" {
+					calls++
+				}
+			}
+
+			if len(requests) != calls*2 {
+				t.Errorf("requests = %d, want %d", len(requests), calls*2)
+			}
+
+			for _, url := range requests {
+				if !strings.Contains(url, "apikey=key") {
+					t.Errorf("request %q lacks the API key", url)
+				}
+			}
+		})
+	}
+}
+
+/* exporter_test.go ends here. */
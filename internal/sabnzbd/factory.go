@@ -0,0 +1,98 @@
+/*
+ * factory.go --- Exporter factory.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package sabnzbd
+
+import (
+	"github.com/Asmodai/master-exporter/internal/exporter"
+	"github.com/Asmodai/master-exporter/internal/quota"
+
+	"errors"
+)
+
+func init() {
+	exporter.Register("sabnzbd", Factory)
+	exporter.RegisterCheck("sabnzbd", Check)
+}
+
+func decodeConfig(inst *exporter.Instance) (*Config, error) {
+	cnf := NewDefaultConfig()
+
+	// Report decoding problems along with anything else that is wrong.
+	err := errors.Join(
+		exporter.Decode(inst.Config, cnf),
+		cnf.readKey(),
+		Validate(cnf),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return cnf, nil
+}
+
+func Check(inst *exporter.Instance) error {
+	_, err := decodeConfig(inst)
+
+	return err
+}
+
+func Factory(deps *exporter.Deps, inst *exporter.Instance) (exporter.IExporter, error) {
+	cnf, err := decodeConfig(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := quota.New(
+		inst.ProcessName(),
+		cnf.Quota,
+		deps.Registerer,
+		deps.State.Entry(inst.ProcessName()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	exp, err := NewExporter(
+		deps.Client,
+		deps.Logger,
+		deps.Registerer,
+		q,
+		cnf,
+	)
+	if err != nil {
+		q.Close()
+
+		return nil, err
+	}
+
+	return exp, nil
+}
+
+/* factory.go ends here. */
@@ -33,11 +33,10 @@ import (
 	"github.com/Asmodai/master-exporter/internal/metrics"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-func NewGauge(name string) prometheus.Gauge {
-	return promauto.NewGauge(prometheus.GaugeOpts{
+func NewGauge(group *metrics.Group, name string) prometheus.Gauge {
+	return group.Gauge(prometheus.GaugeOpts{
 		Namespace: "sabnzbd",
 		Name:      name,
 		Help:      "SabNZBd data.",
@@ -45,7 +44,7 @@ func NewGauge(name string) prometheus.Gauge {
 }
 
 func NewServerGauge(name, server string) prometheus.Gauge {
-	return promauto.NewGauge(prometheus.GaugeOpts{
+	return prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: "sabnzbd",
 		Name:      name,
 		Help:      "SabNZBd data.",
@@ -72,29 +71,38 @@ type Metrics struct {
 	XferTotal  prometheus.Gauge
 	ServerXfer map[string]prometheus.Gauge
 
-	Calls prometheus.Gauge
-	Limit prometheus.Gauge
+	group *metrics.Group
 }
 
-func NewMetrics() *Metrics {
-	return &Metrics{
-		SpeedLimit:    NewGauge("download_speed_limit"),
-		SpeedLimitAbs: NewGauge("download_speed_limit_abs"),
-		Speed:         NewGauge("download_speed"),
-		Kbs:           NewGauge("download_kb_per_sec"),
-		MbTotal:       NewGauge("queue_mb_total"),
-		MbLeft:        NewGauge("queue_mb_left"),
-		MbDone:        NewGauge("queue_mb_done"),
-		SizeTotal:     NewGauge("queue_size_total"),
-		SizeLeft:      NewGauge("queue_size_left"),
-		TimeLeft:      NewGauge("download_time_left"),
-		SlotCount:     NewGauge("job_slots_count"),
-		SlotTotal:     NewGauge("job_slots_total"),
-		XferTotal:     NewGauge("server_xfer_total"),
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	group := metrics.NewGroup(reg)
+
+	m := &Metrics{
+		SpeedLimit:    NewGauge(group, "download_speed_limit"),
+		SpeedLimitAbs: NewGauge(group, "download_speed_limit_abs"),
+		Speed:         NewGauge(group, "download_speed"),
+		Kbs:           NewGauge(group, "download_kb_per_sec"),
+		MbTotal:       NewGauge(group, "queue_mb_total"),
+		MbLeft:        NewGauge(group, "queue_mb_left"),
+		MbDone:        NewGauge(group, "queue_mb_done"),
+		SizeTotal:     NewGauge(group, "queue_size_total"),
+		SizeLeft:      NewGauge(group, "queue_size_left"),
+		TimeLeft:      NewGauge(group, "download_time_left"),
+		SlotCount:     NewGauge(group, "job_slots_count"),
+		SlotTotal:     NewGauge(group, "job_slots_total"),
+		XferTotal:     NewGauge(group, "server_xfer_total"),
 		ServerXfer:    map[string]prometheus.Gauge{},
-		Calls:         metrics.NewMetricsGauge("calls", "sabnzbd"),
-		Limit:         metrics.NewMetricsGauge("limit", "sabnzbd"),
+
+		group: group,
+	}
+
+	if err := group.Err(); err != nil {
+		group.UnregisterAll()
+
+		return nil, err
 	}
+
+	return m, nil
 }
 
 func (m *Metrics) SetSpeedLimit(v float64)    { m.SpeedLimit.Set(v) }
@@ -111,15 +119,27 @@ func (m *Metrics) SetSlotCount(v float64)     { m.SlotCount.Set(v) }
 func (m *Metrics) SetSlotTotal(v float64)     { m.SlotTotal.Set(v) }
 func (m *Metrics) SetXferTotal(v float64)     { m.XferTotal.Set(v) }
 
-func (m *Metrics) SetServerXfer(name string, v float64) {
+func (m *Metrics) SetServerXfer(name string, v float64) error {
 	if _, ok := m.ServerXfer[name]; !ok {
-		m.ServerXfer[name] = NewServerGauge("xfer", name)
+		gauge := NewServerGauge("xfer", name)
+		if err := m.group.Register(gauge); err != nil {
+			return err
+		}
+
+		m.ServerXfer[name] = gauge
 	}
 
 	m.ServerXfer[name].Set(v)
+
+	return nil
 }
 
-func (m *Metrics) SetCalls(val float64) { m.Calls.Set(val) }
-func (m *Metrics) SetLimit(val float64) { m.Limit.Set(val) }
+func (m *Metrics) Register() error {
+	return m.group.RegisterAll()
+}
+
+func (m *Metrics) Unregister() {
+	m.group.UnregisterAll()
+}
 
 /* metrics.go ends here. */
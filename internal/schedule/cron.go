@@ -0,0 +1,194 @@
+/*
+ * cron.go --- Cron-style time matching.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type field struct {
+	name string
+	min  int
+	max  int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// A cron-style time specification.
+//
+// This has the usual five fields: minute, hour, day of month, month and
+// day of week, where Sunday is either 0 or 7.  Each field is `*`, a
+// value, a range `a-b`, or a comma-separated list of these, and `*` and
+// ranges may be followed by a step `/n`.  As with cron, if both the day
+// of month and day of week are restricted then either may match.
+type Cron struct {
+	sets [5]map[int]bool
+	any  [5]bool
+}
+
+func ParseCron(expr string) (*Cron, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf(
+			"'%s' has %d fields, not %d",
+			expr,
+			len(parts),
+			len(fields),
+		)
+	}
+
+	c := &Cron{}
+	for idx, part := range parts {
+		set, err := parseField(part, fields[idx])
+		if err != nil {
+			return nil, err
+		}
+
+		c.sets[idx] = set
+		c.any[idx] = strings.HasPrefix(part, "*")
+	}
+
+	// Sunday is both 0 and 7.
+	if c.sets[4][7] {
+		c.sets[4][0] = true
+	}
+
+	return c, nil
+}
+
+func parseField(spec string, f field) (map[int]bool, error) {
+	set := map[int]bool{}
+
+	for _, item := range strings.Split(spec, ",") {
+		rng, step, stepped := strings.Cut(item, "/")
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+
+			var err error
+			if lo, err = parseValue(a, f); err != nil {
+				return nil, err
+			}
+
+			if hi, err = parseValue(b, f); err != nil {
+				return nil, err
+			}
+
+			if lo > hi {
+				return nil, fmt.Errorf("%s: bad range '%s'", f.name, rng)
+			}
+
+		default:
+			val, err := parseValue(rng, f)
+			if err != nil {
+				return nil, err
+			}
+
+			if stepped {
+				return nil, fmt.Errorf("%s: step without range in '%s'", f.name, item)
+			}
+
+			lo, hi = val, val
+		}
+
+		inc := 1
+		if stepped {
+			n, err := strconv.Atoi(step)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("%s: bad step '%s'", f.name, step)
+			}
+
+			inc = n
+		}
+
+		for val := lo; val <= hi; val += inc {
+			set[val] = true
+		}
+	}
+
+	return set, nil
+}
+
+func parseValue(text string, f field) (int, error) {
+	val, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("%s: bad value '%s'", f.name, text)
+	}
+
+	if val < f.min || val > f.max {
+		return 0, fmt.Errorf(
+			"%s: %d is not between %d and %d",
+			f.name,
+			val,
+			f.min,
+			f.max,
+		)
+	}
+
+	return val, nil
+}
+
+// Does the given time match the specification?
+func (c *Cron) Matches(t time.Time) bool {
+	if !c.sets[0][t.Minute()] || !c.sets[1][t.Hour()] || !c.sets[3][int(t.Month())] {
+		return false
+	}
+
+	dom := c.sets[2][t.Day()]
+	dow := c.sets[4][int(t.Weekday())]
+
+	switch {
+	case c.any[2] && c.any[4]:
+		return true
+
+	case c.any[2]:
+		return dow
+
+	case c.any[4]:
+		return dom
+	}
+
+	return dom || dow
+}
+
+/* cron.go ends here. */
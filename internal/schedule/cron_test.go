@@ -0,0 +1,124 @@
+/*
+ * cron_test.go --- Tests for cron specifications.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"0 0 1 1 0", false},
+		{"*/15 0-5,22-23 * * 1-5", false},
+		{"0 0 * * 7", false},
+		{"0-30/10 * * * *", false},
+		{"", true},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"*/x * * * *", true},
+		{"5/2 * * * *", true},
+		{"a * * * *", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	// 2024-05-05 is a Sunday.
+	tests := []struct {
+		expr string
+		when string
+		want bool
+	}{
+		{"* * * * *", "2024-05-01T10:17:00Z", true},
+		{"17 10 * * *", "2024-05-01T10:17:00Z", true},
+		{"18 10 * * *", "2024-05-01T10:17:00Z", false},
+		{"*/15 * * * *", "2024-05-01T10:45:00Z", true},
+		{"*/15 * * * *", "2024-05-01T10:46:00Z", false},
+		{"0-30/10 * * * *", "2024-05-01T10:20:00Z", true},
+		{"0-30/10 * * * *", "2024-05-01T10:40:00Z", false},
+		{"* 0-5,22-23 * * *", "2024-05-01T23:00:00Z", true},
+		{"* 0-5,22-23 * * *", "2024-05-01T12:00:00Z", false},
+		{"* * * 5 *", "2024-05-01T12:00:00Z", true},
+		{"* * * 6 *", "2024-05-01T12:00:00Z", false},
+		{"* * * * 0", "2024-05-05T12:00:00Z", true},
+		{"* * * * 7", "2024-05-05T12:00:00Z", true},
+		{"* * * * 1-5", "2024-05-05T12:00:00Z", false},
+		{"* * 1 * *", "2024-05-01T12:00:00Z", true},
+
+		// Both days restricted: either may match.
+		{"* * 1 * 0", "2024-05-01T12:00:00Z", true},
+		{"* * 1 * 0", "2024-05-05T12:00:00Z", true},
+		{"* * 1 * 0", "2024-05-06T12:00:00Z", false},
+
+		// A starred field does not widen the other.
+		{"* * */2 * 0", "2024-05-05T12:00:00Z", true},
+		{"* * * * 0", "2024-05-01T12:00:00Z", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr+" "+tt.when, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			when, err := time.Parse(time.RFC3339, tt.when)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := c.Matches(when); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/* cron_test.go ends here. */
@@ -0,0 +1,206 @@
+/*
+ * schedule.go --- Adaptive scrape scheduling.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package schedule
+
+import (
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"fmt"
+	"time"
+)
+
+const (
+	// Call at the exporter's interval.
+	ModeFixed string = "fixed"
+
+	// Call as often as the remaining API budget allows.
+	ModeAdaptive string = "adaptive"
+)
+
+// A period during which calls are made at a different interval, such
+// as overnight.
+type Period struct {
+	Cron     string `json:"cron"`
+	Interval int    `json:"interval"`
+}
+
+type Config struct {
+	Mode string `json:"mode"`
+
+	// Bounds on the adaptive interval.  The lower bound defaults to the
+	// exporter's interval.
+	MinInterval int `json:"min_interval"`
+	MaxInterval int `json:"max_interval"`
+
+	// Periods are matched in the given timezone, or the local timezone
+	// if none is given.
+	Timezone string    `json:"timezone"`
+	Periods  []*Period `json:"periods"`
+}
+
+func NewDefaultConfig() *Config {
+	return &Config{
+		Mode:        ModeFixed,
+		MinInterval: 0,
+		MaxInterval: 3600,
+		Timezone:    "",
+		Periods:     []*Period{},
+	}
+}
+
+// Check the configuration, returning every problem found.
+func Validate(cnf *Config) error {
+	if cnf == nil {
+		return fmt.Errorf("No configuration.")
+	}
+
+	c := validate.NewChecker()
+	c.OneOf("mode", cnf.Mode, ModeFixed, ModeAdaptive)
+	c.AtLeast("min_interval", cnf.MinInterval, 0)
+	c.Positive("max_interval", cnf.MaxInterval)
+
+	if cnf.MinInterval > cnf.MaxInterval {
+		c.Fail("min_interval", "must not be greater than max_interval")
+	}
+
+	if _, err := loadLocation(cnf.Timezone); err != nil {
+		c.Fail("timezone", "unknown timezone '%s'", cnf.Timezone)
+	}
+
+	for idx, period := range cnf.Periods {
+		path := fmt.Sprintf("periods[%d]", idx)
+
+		if period == nil {
+			c.Fail(path, "is empty")
+
+			continue
+		}
+
+		if _, err := ParseCron(period.Cron); err != nil {
+			c.Fail(path+".cron", "%s", err.Error())
+		}
+		c.Positive(path+".interval", period.Interval)
+	}
+
+	return c.Err()
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+
+	return time.LoadLocation(name)
+}
+
+type period struct {
+	cron     *Cron
+	interval time.Duration
+}
+
+// Works out how long to wait between calls.
+//
+// Within a period, calls are made at the period's interval.  Otherwise
+// a fixed schedule uses the exporter's own interval, and an adaptive
+// schedule spreads the remaining API budget over the rest of the quota
+// window, within the configured bounds.  Should calls keep returning
+// the same data, the wait is doubled each time, up to the upper bound.
+type Schedule struct {
+	cnf     *Config
+	loc     *time.Location
+	periods []*period
+}
+
+// Create a schedule from a configuration that has been validated.
+func New(cnf *Config) *Schedule {
+	s := &Schedule{
+		cnf:     cnf,
+		loc:     time.Local,
+		periods: []*period{},
+	}
+
+	if loc, err := loadLocation(cnf.Timezone); err == nil {
+		s.loc = loc
+	}
+
+	for _, p := range cnf.Periods {
+		cron, err := ParseCron(p.Cron)
+		if err != nil {
+			continue
+		}
+
+		s.periods = append(s.periods, &period{
+			cron:     cron,
+			interval: time.Duration(p.Interval) * time.Second,
+		})
+	}
+
+	return s
+}
+
+// Return the wait before the next call.
+//
+// `base` is the exporter's interval, `pace` is the wait that would
+// spread the remaining budget evenly (zero if there is no budget), and
+// `unchanged` counts the calls in a row that returned the same data.
+func (s *Schedule) Interval(now time.Time, base, pace time.Duration, unchanged int) time.Duration {
+	for _, p := range s.periods {
+		if p.cron.Matches(now.In(s.loc)) {
+			return p.interval
+		}
+	}
+
+	if s.cnf.Mode != ModeAdaptive {
+		return base
+	}
+
+	lo := base
+	if s.cnf.MinInterval > 0 {
+		lo = time.Duration(s.cnf.MinInterval) * time.Second
+	}
+	hi := time.Duration(s.cnf.MaxInterval) * time.Second
+
+	wait := pace
+	if wait < lo {
+		wait = lo
+	}
+
+	for i := 0; i < unchanged && wait < hi; i++ {
+		wait *= 2
+	}
+
+	if wait > hi {
+		wait = hi
+	}
+
+	return wait
+}
+
+/* schedule.go ends here. */
@@ -0,0 +1,180 @@
+/*
+ * schedule_test.go --- Tests for call schedules.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cnf     *Config
+		wantErr bool
+	}{
+		{"nil", nil, true},
+		{"default", NewDefaultConfig(), false},
+		{"adaptive", &Config{Mode: ModeAdaptive, MinInterval: 60, MaxInterval: 600}, false},
+		{"bad mode", &Config{Mode: "sometimes", MaxInterval: 600}, true},
+		{"negative min", &Config{Mode: ModeFixed, MinInterval: -1, MaxInterval: 600}, true},
+		{"zero max", &Config{Mode: ModeFixed, MaxInterval: 0}, true},
+		{"min above max", &Config{Mode: ModeAdaptive, MinInterval: 700, MaxInterval: 600}, true},
+		{"bad timezone", &Config{Mode: ModeFixed, MaxInterval: 600, Timezone: "Nowhere/Special"}, true},
+		{
+			"period",
+			&Config{Mode: ModeFixed, MaxInterval: 600, Periods: []*Period{{Cron: "* 0-5 * * *", Interval: 3600}}},
+			false,
+		},
+		{
+			"nil period",
+			&Config{Mode: ModeFixed, MaxInterval: 600, Periods: []*Period{nil}},
+			true,
+		},
+		{
+			"bad period cron",
+			&Config{Mode: ModeFixed, MaxInterval: 600, Periods: []*Period{{Cron: "* *", Interval: 3600}}},
+			true,
+		},
+		{
+			"bad period interval",
+			&Config{Mode: ModeFixed, MaxInterval: 600, Periods: []*Period{{Cron: "* * * * *", Interval: 0}}},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.cnf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInterval(t *testing.T) {
+	night := []*Period{{Cron: "* 0-5 * * *", Interval: 3600}}
+	day := "2024-05-01T12:00:00Z"
+
+	tests := []struct {
+		name      string
+		cnf       *Config
+		when      string
+		base      time.Duration
+		pace      time.Duration
+		unchanged int
+		want      time.Duration
+	}{
+		{
+			name: "fixed",
+			cnf:  &Config{Mode: ModeFixed, MaxInterval: 3600, Timezone: "UTC"},
+			when: day, base: time.Minute, pace: 10 * time.Minute,
+			want: time.Minute,
+		},
+		{
+			name: "fixed ignores unchanged",
+			cnf:  &Config{Mode: ModeFixed, MaxInterval: 3600, Timezone: "UTC"},
+			when: day, base: time.Minute, unchanged: 3,
+			want: time.Minute,
+		},
+		{
+			name: "period",
+			cnf:  &Config{Mode: ModeFixed, MaxInterval: 3600, Timezone: "UTC", Periods: night},
+			when: "2024-05-01T03:00:00Z", base: time.Minute,
+			want: time.Hour,
+		},
+		{
+			name: "outside period",
+			cnf:  &Config{Mode: ModeFixed, MaxInterval: 3600, Timezone: "UTC", Periods: night},
+			when: "2024-05-01T06:00:00Z", base: time.Minute,
+			want: time.Minute,
+		},
+		{
+			name: "period in timezone",
+			cnf:  &Config{Mode: ModeFixed, MaxInterval: 3600, Timezone: "Asia/Tokyo", Periods: night},
+			when: "2024-05-01T18:00:00Z", base: time.Minute,
+			want: time.Hour,
+		},
+		{
+			name: "adaptive follows pace",
+			cnf:  &Config{Mode: ModeAdaptive, MaxInterval: 3600, Timezone: "UTC"},
+			when: day, base: time.Minute, pace: 5 * time.Minute,
+			want: 5 * time.Minute,
+		},
+		{
+			name: "adaptive no faster than base",
+			cnf:  &Config{Mode: ModeAdaptive, MaxInterval: 3600, Timezone: "UTC"},
+			when: day, base: time.Minute, pace: 10 * time.Second,
+			want: time.Minute,
+		},
+		{
+			name: "adaptive no faster than min",
+			cnf:  &Config{Mode: ModeAdaptive, MinInterval: 600, MaxInterval: 3600, Timezone: "UTC"},
+			when: day, base: time.Minute, pace: 5 * time.Minute,
+			want: 10 * time.Minute,
+		},
+		{
+			name: "adaptive no slower than max",
+			cnf:  &Config{Mode: ModeAdaptive, MaxInterval: 3600, Timezone: "UTC"},
+			when: day, base: time.Minute, pace: 2 * time.Hour,
+			want: time.Hour,
+		},
+		{
+			name: "adaptive backs off",
+			cnf:  &Config{Mode: ModeAdaptive, MaxInterval: 3600, Timezone: "UTC"},
+			when: day, base: time.Minute, pace: 5 * time.Minute, unchanged: 2,
+			want: 20 * time.Minute,
+		},
+		{
+			name: "adaptive backs off to max",
+			cnf:  &Config{Mode: ModeAdaptive, MaxInterval: 3600, Timezone: "UTC"},
+			when: day, base: time.Minute, pace: 5 * time.Minute, unchanged: 10,
+			want: time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			when, err := time.Parse(time.RFC3339, tt.when)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := New(tt.cnf).Interval(when, tt.base, tt.pace, tt.unchanged)
+			if got != tt.want {
+				t.Errorf("Interval() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+/* schedule_test.go ends here. */
@@ -0,0 +1,122 @@
+/*
+ * expand.go --- Environment variable expansion.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package secret
+
+import (
+	"github.com/Asmodai/master-exporter/internal/validate"
+
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+)
+
+var (
+	// `$${` escapes a literal `${`.  Bare `$NAME` is left alone, as
+	// dollar signs are common in password hashes.
+	envRE = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// Expand `${NAME}` references to environment variables in every string
+// value in a JSON document.
+//
+// Keys are left alone.  Referring to a variable that is not set is an
+// error.
+func Expand(data []byte) ([]byte, error) {
+	var doc interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	errs := []error{}
+	doc = expand("", doc, &errs)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return json.Marshal(doc)
+}
+
+func expand(path string, value interface{}, errs *[]error) interface{} {
+	switch v := value.(type) {
+	case string:
+		return expandString(path, v, errs)
+
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			sub := k
+			if path != "" {
+				sub = path + "." + k
+			}
+
+			v[k] = expand(sub, v[k], errs)
+		}
+
+	case []interface{}:
+		for idx := range v {
+			v[idx] = expand(fmt.Sprintf("%s[%d]", path, idx), v[idx], errs)
+		}
+	}
+
+	return value
+}
+
+func expandString(path, value string, errs *[]error) string {
+	return envRE.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+
+		name := envRE.FindStringSubmatch(ref)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			*errs = append(*errs, &validate.FieldError{
+				Path: path,
+				Err:  fmt.Errorf("environment variable '%s' is not set", name),
+			})
+		}
+
+		return env
+	})
+}
+
+/* expand.go ends here. */
@@ -0,0 +1,85 @@
+/*
+ * expand_test.go --- Tests for environment expansion.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package secret
+
+import (
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	t.Setenv("SECRET_TEST_KEY", "abc")
+	t.Setenv("SECRET_TEST_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"plain", `{"a":"b"}`, `{"a":"b"}`, false},
+		{"variable", `{"key":"${SECRET_TEST_KEY}"}`, `{"key":"abc"}`, false},
+		{"embedded", `{"url":"http://h/?k=${SECRET_TEST_KEY}"}`, `{"url":"http://h/?k=abc"}`, false},
+		{"empty", `{"key":"${SECRET_TEST_EMPTY}"}`, `{"key":""}`, false},
+		{"escaped", `{"key":"$${SECRET_TEST_KEY}"}`, `{"key":"${SECRET_TEST_KEY}"}`, false},
+		{"bare dollar", `{"hash":"$2a$10$abc"}`, `{"hash":"$2a$10$abc"}`, false},
+		{"keys untouched", `{"${SECRET_TEST_KEY}":1}`, `{"${SECRET_TEST_KEY}":1}`, false},
+		{"nested", `{"a":[{"b":"${SECRET_TEST_KEY}"}]}`, `{"a":[{"b":"abc"}]}`, false},
+		{"numbers kept", `{"n":1.50}`, `{"n":1.50}`, false},
+		{"unset", `{"key":"${SECRET_TEST_UNSET}"}`, "", true},
+		{"bad json", `{`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand([]byte(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("Expand() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandErrorPath(t *testing.T) {
+	_, err := Expand([]byte(`{"a":{"b":["x","${SECRET_TEST_UNSET}"]}}`))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	want := "a.b[1]: environment variable 'SECRET_TEST_UNSET' is not set"
+	if err.Error() != want {
+		t.Errorf("error = %q, want %q", err.Error(), want)
+	}
+}
+
+/* expand_test.go ends here. */
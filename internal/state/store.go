@@ -0,0 +1,162 @@
+/*
+ * store.go --- On-disk state store.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A store of small pieces of state that should survive a restart, such
+// as call counters.
+//
+// Each entry is kept as a JSON file of its own in the store's directory,
+// and is replaced atomically when saved.  A nil store keeps nothing, so
+// callers need not care whether persistence is configured.
+type Store struct {
+	sync.Mutex
+
+	dir string
+}
+
+// Open the store in the given directory, creating it if need be.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &Store{dir: dir}, nil
+}
+
+// Return the entry with the given key.
+func (s *Store) Entry(key string) *Entry {
+	if s == nil {
+		return nil
+	}
+
+	return &Entry{store: s, key: key}
+}
+
+func (s *Store) path(key string) string {
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(key)
+
+	return filepath.Join(s.dir, name+".json")
+}
+
+// Decode the entry's data into the given value.
+//
+// Returns false if nothing has been saved yet.
+func (s *Store) load(key string, v interface{}) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Save the given value, replacing the entry's data.
+//
+// The data is written to a temporary file which then replaces the
+// entry, so a crash mid-write leaves the old data intact.
+func (s *Store) save(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	path := s.path(key)
+	tmp, err := os.CreateTemp(s.dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// A single entry in a store.
+type Entry struct {
+	store *Store
+	key   string
+}
+
+func (e *Entry) Load(v interface{}) (bool, error) {
+	if e == nil {
+		return false, nil
+	}
+
+	return e.store.load(e.key, v)
+}
+
+func (e *Entry) Save(v interface{}) error {
+	if e == nil {
+		return nil
+	}
+
+	return e.store.save(e.key, v)
+}
+
+/* store.go ends here. */
@@ -0,0 +1,152 @@
+/*
+ * checker.go --- Value checks.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+)
+
+var (
+	hostnameRE = regexp.MustCompile(
+		`^([a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?\.?$`,
+	)
+)
+
+// Collects the problems found in a configuration.
+//
+// Checks do not stop at the first problem, so that every problem can be
+// reported at once.
+type Checker struct {
+	errs []error
+}
+
+func NewChecker() *Checker {
+	return &Checker{errs: []error{}}
+}
+
+// Record a problem with the value at the given path.
+func (c *Checker) Fail(path, format string, args ...interface{}) {
+	c.errs = append(c.errs, &FieldError{
+		Path: path,
+		Err:  fmt.Errorf(format, args...),
+	})
+}
+
+// Record an error, if there is one.
+func (c *Checker) Add(err error) {
+	if err != nil {
+		c.errs = append(c.errs, err)
+	}
+}
+
+func (c *Checker) Required(path, value string) bool {
+	if value == "" {
+		c.Fail(path, "is required")
+
+		return false
+	}
+
+	return true
+}
+
+func (c *Checker) Positive(path string, value int) {
+	if value <= 0 {
+		c.Fail(path, "must be positive")
+	}
+}
+
+func (c *Checker) AtLeast(path string, value, min int) {
+	if value < min {
+		c.Fail(path, "must be at least %d", min)
+	}
+}
+
+func (c *Checker) OneOf(path, value string, allowed ...string) {
+	for _, v := range allowed {
+		if value == v {
+			return
+		}
+	}
+
+	c.Fail(path, "must be one of %v", allowed)
+}
+
+// Check for an absolute HTTP or HTTPS URL.
+func (c *Checker) URL(path, value string) {
+	if !c.Required(path, value) {
+		return
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		c.Fail(path, "invalid URL '%s'", value)
+
+		return
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		c.Fail(path, "'%s' is not an HTTP or HTTPS URL", value)
+	}
+}
+
+// Check for a host name or IP address.
+func (c *Checker) Host(path, value string) {
+	if net.ParseIP(value) != nil {
+		return
+	}
+
+	if len(value) > 253 || !hostnameRE.MatchString(value) {
+		c.Fail(path, "malformed host '%s'", value)
+	}
+}
+
+// Check a non-empty list of host names or IP addresses.
+func (c *Checker) Hosts(path string, hosts []string) {
+	if len(hosts) == 0 {
+		c.Fail(path, "at least one host is required")
+
+		return
+	}
+
+	for idx, host := range hosts {
+		c.Host(fmt.Sprintf("%s[%d]", path, idx), host)
+	}
+}
+
+// Return all problems found, or nil.
+func (c *Checker) Err() error {
+	return errors.Join(c.errs...)
+}
+
+/* checker.go ends here. */
@@ -0,0 +1,181 @@
+/*
+ * decode.go --- Strict decoding.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Decode JSON into the given value, reporting every key that does not
+// correspond to a field.
+//
+// Keys in `ignore` are allowed at the top level; they belong to someone
+// else.
+func Decode(data json.RawMessage, v interface{}, ignore ...string) error {
+	skip := map[string]bool{}
+	for _, k := range ignore {
+		skip[k] = true
+	}
+
+	errs := unknown("", data, reflect.TypeOf(v), skip)
+
+	if err := json.Unmarshal(data, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			err = &FieldError{
+				Path: typeErr.Field,
+				Err:  fmt.Errorf("expected %s, got %s", typeErr.Type, typeErr.Value),
+			}
+		}
+
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Report every key in the JSON that does not correspond to a field in
+// the given value.
+func UnknownKeys(data json.RawMessage, v interface{}) error {
+	return errors.Join(unknown("", data, reflect.TypeOf(v), nil)...)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// Return the JSON keys of a struct type, with their field types.
+func fields(typ reflect.Type) map[string]reflect.Type {
+	keys := map[string]reflect.Type{}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		switch tag {
+		case "-":
+			continue
+
+		case "":
+			tag = field.Name
+		}
+
+		keys[tag] = field.Type
+	}
+
+	return keys
+}
+
+func unknown(path string, data json.RawMessage, typ reflect.Type, skip map[string]bool) []error {
+	errs := []error{}
+
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		obj := map[string]json.RawMessage{}
+
+		// Anything that is not an object is left to the decoder.
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return errs
+		}
+
+		keys := fields(typ)
+		names := []string{}
+		for k := range obj {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, k := range names {
+			ftyp, ok := keys[k]
+
+			switch {
+			case skip[k]:
+
+			case !ok:
+				errs = append(errs, &FieldError{
+					Path: join(path, k),
+					Err:  fmt.Errorf("unknown key"),
+				})
+
+			default:
+				errs = append(errs, unknown(join(path, k), obj[k], ftyp, nil)...)
+			}
+		}
+
+	case reflect.Map:
+		obj := map[string]json.RawMessage{}
+
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return errs
+		}
+
+		names := []string{}
+		for k := range obj {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, k := range names {
+			errs = append(errs, unknown(join(path, k), obj[k], typ.Elem(), nil)...)
+		}
+
+	case reflect.Slice:
+		list := []json.RawMessage{}
+
+		if err := json.Unmarshal(data, &list); err != nil {
+			return errs
+		}
+
+		for idx, elt := range list {
+			errs = append(errs, unknown(fmt.Sprintf("%s[%d]", path, idx), elt, typ.Elem(), nil)...)
+		}
+	}
+
+	return errs
+}
+
+/* decode.go ends here. */
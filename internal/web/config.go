@@ -0,0 +1,262 @@
+/*
+ * config.go --- Web server configuration.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package web
+
+import (
+	"gopkg.in/yaml.v3"
+
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+/*
+The configuration follows the web configuration format of the Prometheus
+exporter-toolkit, so an existing `web-config.yml` can be used either by
+pointing `config_file` at it or by copying its contents into the `web`
+section.
+
+We add an allow-list of client networks and server timeouts, which the
+exporter-toolkit format lacks.
+*/
+
+type TLSConfig struct {
+	CertFile   string `json:"cert_file" yaml:"cert_file"`
+	KeyFile    string `json:"key_file" yaml:"key_file"`
+	ClientAuth string `json:"client_auth_type" yaml:"client_auth_type"`
+	ClientCAs  string `json:"client_ca_file" yaml:"client_ca_file"`
+	MinVersion string `json:"min_version" yaml:"min_version"`
+	MaxVersion string `json:"max_version" yaml:"max_version"`
+}
+
+type HTTPConfig struct {
+	HTTP2   *bool             `json:"http2" yaml:"http2"`
+	Headers map[string]string `json:"headers" yaml:"headers"`
+}
+
+type Config struct {
+	// Path to an exporter-toolkit web configuration file.  Settings in
+	// the file replace the TLS, HTTP and user settings given here.
+	ConfigFile string `json:"config_file" yaml:"-"`
+
+	TLS   *TLSConfig        `json:"tls_server_config" yaml:"tls_server_config"`
+	HTTP  *HTTPConfig       `json:"http_server_config" yaml:"http_server_config"`
+	Users map[string]string `json:"basic_auth_users" yaml:"basic_auth_users"`
+
+	AllowedCIDRs []string `json:"allowed_cidrs" yaml:"allowed_cidrs"`
+
+	// Timeouts.  Seconds.
+	ReadTimeout       int `json:"read_timeout" yaml:"read_timeout"`
+	ReadHeaderTimeout int `json:"read_header_timeout" yaml:"read_header_timeout"`
+	WriteTimeout      int `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout       int `json:"idle_timeout" yaml:"idle_timeout"`
+	ShutdownTimeout   int `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+
+	networks []*net.IPNet
+}
+
+var (
+	clientAuthTypes map[string]tls.ClientAuthType = map[string]tls.ClientAuthType{
+		"":                           tls.NoClientCert,
+		"NoClientCert":               tls.NoClientCert,
+		"RequestClientCert":          tls.RequestClientCert,
+		"RequireAnyClientCert":       tls.RequireAnyClientCert,
+		"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+		"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+	}
+
+	tlsVersions map[string]uint16 = map[string]uint16{
+		"TLS10": tls.VersionTLS10,
+		"TLS11": tls.VersionTLS11,
+		"TLS12": tls.VersionTLS12,
+		"TLS13": tls.VersionTLS13,
+	}
+)
+
+func NewDefaultConfig() *Config {
+	return &Config{
+		ReadTimeout:       30,
+		ReadHeaderTimeout: 10,
+		WriteTimeout:      60,
+		IdleTimeout:       120,
+		ShutdownTimeout:   10,
+	}
+}
+
+// Load the exporter-toolkit configuration file, if there is one, and
+// check the configuration.
+//
+// Relative paths in a configuration file are relative to the file.
+func Validate(cnf *Config) error {
+	if cnf.ConfigFile != "" {
+		if err := cnf.load(); err != nil {
+			return err
+		}
+	}
+
+	def := NewDefaultConfig()
+	if cnf.ReadTimeout <= 0 {
+		cnf.ReadTimeout = def.ReadTimeout
+	}
+
+	if cnf.ReadHeaderTimeout <= 0 {
+		cnf.ReadHeaderTimeout = def.ReadHeaderTimeout
+	}
+
+	if cnf.WriteTimeout <= 0 {
+		cnf.WriteTimeout = def.WriteTimeout
+	}
+
+	if cnf.IdleTimeout <= 0 {
+		cnf.IdleTimeout = def.IdleTimeout
+	}
+
+	if cnf.ShutdownTimeout <= 0 {
+		cnf.ShutdownTimeout = def.ShutdownTimeout
+	}
+
+	cnf.networks = []*net.IPNet{}
+	for idx, cidr := range cnf.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("web.allowed_cidrs[%d]: %s", idx, err.Error())
+		}
+
+		cnf.networks = append(cnf.networks, network)
+	}
+
+	if cnf.TLS != nil {
+		if cnf.TLS.CertFile == "" || cnf.TLS.KeyFile == "" {
+			return fmt.Errorf("web.tls_server_config: cert_file and key_file are required")
+		}
+
+		auth, ok := clientAuthTypes[cnf.TLS.ClientAuth]
+		if !ok {
+			return fmt.Errorf(
+				"web.tls_server_config.client_auth_type: unknown type '%s'",
+				cnf.TLS.ClientAuth,
+			)
+		}
+
+		// Without a CA, client certificates would be verified against
+		// the system roots, which is never what is wanted.
+		verify := auth == tls.VerifyClientCertIfGiven ||
+			auth == tls.RequireAndVerifyClientCert
+		if verify && cnf.TLS.ClientCAs == "" {
+			return fmt.Errorf(
+				"web.tls_server_config.client_ca_file: required when client_auth_type is '%s'",
+				cnf.TLS.ClientAuth,
+			)
+		}
+
+		for _, v := range []string{cnf.TLS.MinVersion, cnf.TLS.MaxVersion} {
+			if _, ok := tlsVersions[v]; v != "" && !ok {
+				return fmt.Errorf("web.tls_server_config: unknown TLS version '%s'", v)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) load() error {
+	data, err := os.ReadFile(c.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	file := &Config{}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return fmt.Errorf("%s: %s", c.ConfigFile, err.Error())
+	}
+
+	if file.TLS != nil {
+		dir := filepath.Dir(c.ConfigFile)
+		for _, path := range []*string{&file.TLS.CertFile, &file.TLS.KeyFile, &file.TLS.ClientCAs} {
+			if *path != "" && !filepath.IsAbs(*path) {
+				*path = filepath.Join(dir, *path)
+			}
+		}
+	}
+
+	c.TLS = file.TLS
+	c.HTTP = file.HTTP
+	c.Users = file.Users
+
+	return nil
+}
+
+// Is TLS enabled?
+func (c *Config) UseTLS() bool {
+	return c.TLS != nil
+}
+
+// Build the TLS configuration for the server.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cnf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuthTypes[c.TLS.ClientAuth],
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if v, ok := tlsVersions[c.TLS.MinVersion]; ok {
+		cnf.MinVersion = v
+	}
+
+	if v, ok := tlsVersions[c.TLS.MaxVersion]; ok {
+		cnf.MaxVersion = v
+	}
+
+	if c.TLS.ClientCAs != "" {
+		pem, err := os.ReadFile(c.TLS.ClientCAs)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", c.TLS.ClientCAs)
+		}
+
+		cnf.ClientCAs = pool
+	}
+
+	return cnf, nil
+}
+
+/* config.go ends here. */
@@ -0,0 +1,159 @@
+/*
+ * config_test.go --- Web configuration tests.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package web
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name:   "defaults",
+			config: `{}`,
+		},
+		{
+			name:   "networks",
+			config: `{"allowed_cidrs": ["10.0.0.0/8", "::1/128"]}`,
+		},
+		{
+			name:   "bad network",
+			config: `{"allowed_cidrs": ["10.0.0.0/8", "10.0.0.0"]}`,
+			err:    "web.allowed_cidrs[1]: invalid CIDR address: 10.0.0.0",
+		},
+		{
+			name:   "no key",
+			config: `{"tls_server_config": {"cert_file": "cert.pem"}}`,
+			err:    "web.tls_server_config: cert_file and key_file are required",
+		},
+		{
+			name: "unknown client auth",
+			config: `{"tls_server_config": {"cert_file": "c", "key_file": "k",
+				"client_auth_type": "Maybe"}}`,
+			err: "web.tls_server_config.client_auth_type: unknown type 'Maybe'",
+		},
+		{
+			name: "verify without CA",
+			config: `{"tls_server_config": {"cert_file": "c", "key_file": "k",
+				"client_auth_type": "RequireAndVerifyClientCert"}}`,
+			err: "web.tls_server_config.client_ca_file: required when client_auth_type is 'RequireAndVerifyClientCert'",
+		},
+		{
+			name: "verify with CA",
+			config: `{"tls_server_config": {"cert_file": "c", "key_file": "k",
+				"client_auth_type": "RequireAndVerifyClientCert", "client_ca_file": "ca"}}`,
+		},
+		{
+			name: "unknown version",
+			config: `{"tls_server_config": {"cert_file": "c", "key_file": "k",
+				"min_version": "SSL3"}}`,
+			err: "web.tls_server_config: unknown TLS version 'SSL3'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cnf := &Config{}
+			if err := json.Unmarshal([]byte(tt.config), cnf); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Validate(cnf)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %s", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Unset timeouts take their defaults.
+			def := NewDefaultConfig()
+			if cnf.ReadTimeout != def.ReadTimeout || cnf.ShutdownTimeout != def.ShutdownTimeout {
+				t.Errorf("timeouts not defaulted: %+v", cnf)
+			}
+
+			if len(cnf.networks) != len(cnf.AllowedCIDRs) {
+				t.Errorf("%d networks, want %d", len(cnf.networks), len(cnf.AllowedCIDRs))
+			}
+		})
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "web-config.yml")
+
+	err := os.WriteFile(file, []byte(`
+tls_server_config:
+  cert_file: server.crt
+  key_file: /etc/ssl/server.key
+basic_auth_users:
+  alice: $2y$10$hash
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := &Config{
+		ConfigFile: file,
+		Users:      map[string]string{"bob": "replaced"},
+	}
+
+	if err := Validate(cnf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Relative paths are relative to the file.
+	if want := filepath.Join(dir, "server.crt"); cnf.TLS.CertFile != want {
+		t.Errorf("cert_file = %s, want %s", cnf.TLS.CertFile, want)
+	}
+
+	if cnf.TLS.KeyFile != "/etc/ssl/server.key" {
+		t.Errorf("key_file = %s, want it unchanged", cnf.TLS.KeyFile)
+	}
+
+	if _, ok := cnf.Users["bob"]; ok || len(cnf.Users) != 1 {
+		t.Errorf("users = %v, want only those in the file", cnf.Users)
+	}
+}
+
+/* config_test.go ends here. */
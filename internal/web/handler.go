@@ -0,0 +1,154 @@
+/*
+ * handler.go --- Access control.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package web
+
+import (
+	"golang.org/x/crypto/bcrypt"
+
+	"crypto/sha256"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Compared against when the user is unknown, so that unknown users take
+// as long to reject as known users with a bad password.
+var (
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+func dummy() string {
+	dummyOnce.Do(func() {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+		dummyHash = string(hash)
+	})
+
+	return dummyHash
+}
+
+type authCache struct {
+	sync.Mutex
+
+	seen map[[sha256.Size]byte]bool
+}
+
+// bcrypt is deliberately slow, so successful checks are cached.
+func (c *authCache) check(user, hash, pass string) bool {
+	key := sha256.Sum256([]byte(user + "\x00" + hash + "\x00" + pass))
+
+	c.Lock()
+	ok := c.seen[key]
+	c.Unlock()
+
+	if ok {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+		return false
+	}
+
+	c.Lock()
+	c.seen[key] = true
+	c.Unlock()
+
+	return true
+}
+
+// Wrap a handler with the access controls given in the configuration.
+//
+// Clients are checked against the allowed networks, then against the
+// basic authentication users.  Configured headers are added to every
+// response.
+func (c *Config) Handler(next http.Handler) http.Handler {
+	cache := &authCache{seen: map[[sha256.Size]byte]bool{}}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.HTTP != nil {
+			for k, v := range c.HTTP.Headers {
+				w.Header().Set(k, v)
+			}
+		}
+
+		if !c.allowed(r.RemoteAddr) {
+			http.Error(w, "Forbidden.", http.StatusForbidden)
+
+			return
+		}
+
+		if len(c.Users) > 0 {
+			user, pass, ok := r.BasicAuth()
+			hash, known := c.Users[user]
+			if !known {
+				hash = dummy()
+			}
+
+			if !cache.check(user, hash, pass) || !ok || !known {
+				w.Header().Set("WWW-Authenticate", `Basic realm="master-exporter"`)
+				http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Is the remote address in one of the allowed networks?
+//
+// Connections that do not come from an IP address, such as those over a
+// Unix socket, are always allowed.
+func (c *Config) allowed(remote string) bool {
+	if len(c.networks) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return true
+	}
+
+	for _, network := range c.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/* handler.go ends here. */
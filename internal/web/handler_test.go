@@ -0,0 +1,100 @@
+/*
+ * handler_test.go --- Web access control tests.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package web
+
+import (
+	"golang.org/x/crypto/bcrypt"
+
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := &Config{
+		AllowedCIDRs: []string{"10.0.0.0/8"},
+		Users:        map[string]string{"alice": string(hash)},
+		HTTP: &HTTPConfig{
+			Headers: map[string]string{"X-Test": "yes"},
+		},
+	}
+
+	if err := Validate(cnf); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := cnf.Handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		remote string
+		user   string
+		pass   string
+		want   int
+	}{
+		{"allowed", "10.1.2.3:1234", "alice", "secret", http.StatusNoContent},
+		{"again", "10.1.2.3:1234", "alice", "secret", http.StatusNoContent},
+		{"wrong network", "192.168.1.1:1234", "alice", "secret", http.StatusForbidden},
+		{"unix socket", "@", "alice", "secret", http.StatusNoContent},
+		{"wrong password", "10.1.2.3:1234", "alice", "guess", http.StatusUnauthorized},
+		{"unknown user", "10.1.2.3:1234", "mallory", "secret", http.StatusUnauthorized},
+		{"no credentials", "10.1.2.3:1234", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = tt.remote
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+
+			if rec.Header().Get("X-Test") != "yes" {
+				t.Error("configured header missing")
+			}
+		})
+	}
+}
+
+/* handler_test.go ends here. */
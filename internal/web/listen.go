@@ -0,0 +1,317 @@
+/*
+ * listen.go --- Listeners.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package web
+
+import (
+	"github.com/coreos/go-systemd/v22/activation"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	unixPrefix    string = "unix:"
+	systemdPrefix string = "systemd:"
+)
+
+// An address to listen on.
+//
+// The address is one of:
+//
+//	host:port          TCP, e.g. `127.0.0.1:9500` or `[::1]:9500`
+//	unix:/path         Unix socket, created with the given mode and owner
+//	systemd:           every socket passed by systemd
+//	systemd:name       sockets passed by systemd with `FileDescriptorName`
+//
+// A plain string may be given in place of an object.
+type Listen struct {
+	Address string `json:"address"`
+	Mode    string `json:"mode"`
+	Owner   string `json:"owner"`
+	Group   string `json:"group"`
+}
+
+func (l *Listen) UnmarshalJSON(data []byte) error {
+	var addr string
+
+	if err := json.Unmarshal(data, &addr); err == nil {
+		l.Address = addr
+
+		return nil
+	}
+
+	type plain Listen
+
+	return json.Unmarshal(data, (*plain)(l))
+}
+
+// Check a list of listen addresses.
+func ValidateListen(addrs []*Listen) error {
+	for idx, l := range addrs {
+		switch {
+		case l == nil || l.Address == "":
+			return fmt.Errorf("listen[%d]: address is required", idx)
+
+		case strings.HasPrefix(l.Address, systemdPrefix):
+
+		case strings.HasPrefix(l.Address, unixPrefix):
+			if l.Address == unixPrefix {
+				return fmt.Errorf("listen[%d]: socket path is required", idx)
+			}
+
+			if _, err := l.mode(); err != nil {
+				return fmt.Errorf("listen[%d].mode: %s", idx, err.Error())
+			}
+
+		default:
+			if _, _, err := net.SplitHostPort(l.Address); err != nil {
+				return fmt.Errorf("listen[%d]: %s", idx, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *Listen) mode() (fs.FileMode, error) {
+	if l.Mode == "" {
+		return 0o660, nil
+	}
+
+	mode, err := strconv.ParseUint(l.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid mode '%s'", l.Mode)
+	}
+
+	return fs.FileMode(mode), nil
+}
+
+// Open listeners for every address.
+//
+// Should any fail, those already opened are closed.
+func Listeners(addrs []*Listen) ([]net.Listener, error) {
+	listeners := []net.Listener{}
+
+	var inherited map[string][]net.Listener
+
+	for _, l := range addrs {
+		var (
+			opened []net.Listener
+			err    error
+		)
+
+		switch {
+		case strings.HasPrefix(l.Address, systemdPrefix):
+			if inherited == nil {
+				inherited, err = activation.ListenersWithNames()
+				if err != nil {
+					break
+				}
+			}
+
+			opened, err = l.systemd(inherited)
+
+		case strings.HasPrefix(l.Address, unixPrefix):
+			var listener net.Listener
+
+			listener, err = l.unix()
+			opened = []net.Listener{listener}
+
+		default:
+			var listener net.Listener
+
+			listener, err = net.Listen("tcp", l.Address)
+			opened = []net.Listener{listener}
+		}
+
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+
+			return nil, fmt.Errorf("%s: %s", l.Address, err.Error())
+		}
+
+		listeners = append(listeners, opened...)
+	}
+
+	return listeners, nil
+}
+
+func (l *Listen) systemd(inherited map[string][]net.Listener) ([]net.Listener, error) {
+	name := strings.TrimPrefix(l.Address, systemdPrefix)
+	opened := []net.Listener{}
+
+	for k, v := range inherited {
+		if name == "" || name == k {
+			opened = append(opened, v...)
+		}
+	}
+
+	if len(opened) == 0 {
+		return nil, fmt.Errorf("No sockets passed by systemd.")
+	}
+
+	return opened, nil
+}
+
+func (l *Listen) unix() (net.Listener, error) {
+	path := strings.TrimPrefix(l.Address, unixPrefix)
+
+	// Remove a socket left behind by an earlier run, but nothing else.
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("File exists and is not a socket.")
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// The socket is created in a private directory and only moved into
+	// place once it has its mode and owner, so that nobody can connect
+	// to it in between.
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".socket-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, filepath.Base(path))
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	// Otherwise closing the listener would remove the temporary path
+	// rather than the socket.
+	listener.SetUnlinkOnClose(false)
+
+	if err := l.chown(tmp); err != nil {
+		listener.Close()
+
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+
+		return nil, err
+	}
+
+	return &unixListener{UnixListener: listener, path: path}, nil
+}
+
+// A Unix socket listener that removes its socket once closed.
+type unixListener struct {
+	*net.UnixListener
+
+	path string
+}
+
+func (u *unixListener) Close() error {
+	err := u.UnixListener.Close()
+
+	if rerr := os.Remove(u.path); err == nil && !errors.Is(rerr, fs.ErrNotExist) {
+		err = rerr
+	}
+
+	return err
+}
+
+func (l *Listen) chown(path string) error {
+	mode, err := l.mode()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+
+	if l.Owner == "" && l.Group == "" {
+		return nil
+	}
+
+	uid, gid := -1, -1
+
+	if l.Owner != "" {
+		if uid, err = lookupID(l.Owner, func(name string) (string, error) {
+			usr, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+
+			return usr.Uid, nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if l.Group != "" {
+		if gid, err = lookupID(l.Group, func(name string) (string, error) {
+			grp, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+
+			return grp.Gid, nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	return os.Chown(path, uid, gid)
+}
+
+// Resolve a user or group name, which may also be numeric.
+func lookupID(name string, fn func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	id, err := fn(name)
+	if err != nil {
+		return -1, err
+	}
+
+	return strconv.Atoi(id)
+}
+
+/* listen.go ends here. */
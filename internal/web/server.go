@@ -0,0 +1,125 @@
+/*
+ * server.go --- HTTP server.
+ *
+ * Copyright (c) 2024 Paul Ward <asmodai@gmail.com>
+ *
+ * Author:     Paul Ward <asmodai@gmail.com>
+ * Maintainer: Paul Ward <asmodai@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person
+ * obtaining a copy of this software and associated documentation files
+ * (the "Software"), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge,
+ * publish, distribute, sublicense, and/or sell copies of the Software,
+ * and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be
+ * included in all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+ * EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+ * MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+ * NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS
+ * BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN
+ * ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package web
+
+import (
+	"github.com/Asmodai/gohacks/logger"
+
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+type Server struct {
+	cnf *Config
+	srv *http.Server
+	lgr logger.ILogger
+}
+
+// Create a server for the given handler.
+//
+// The configuration must have been validated.
+func NewServer(cnf *Config, handler http.Handler, lgr logger.ILogger) (*Server, error) {
+	srv := &http.Server{
+		Handler:           cnf.Handler(handler),
+		ReadTimeout:       time.Duration(cnf.ReadTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(cnf.ReadHeaderTimeout) * time.Second,
+		WriteTimeout:      time.Duration(cnf.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(cnf.IdleTimeout) * time.Second,
+	}
+
+	if cnf.UseTLS() {
+		tlsCnf, err := cnf.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		srv.TLSConfig = tlsCnf
+	}
+
+	if cnf.HTTP != nil && cnf.HTTP.HTTP2 != nil && !*cnf.HTTP.HTTP2 {
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+
+	return &Server{cnf: cnf, srv: srv, lgr: lgr}, nil
+}
+
+// Serve on the given listeners until the context is cancelled, then shut
+// down gracefully.
+//
+// Should any listener fail, the server is shut down and the error
+// returned.  Returns nil after a graceful shutdown.
+func (s *Server) Serve(ctx context.Context, listeners ...net.Listener) error {
+	errs := make(chan error, len(listeners))
+
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			errs <- s.serve(listener)
+		}(listener)
+	}
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+
+	timeout := time.Duration(s.cnf.ShutdownTimeout) * time.Second
+	sctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Waits for in-flight requests to finish.
+	if serr := s.srv.Shutdown(sctx); serr != nil {
+		s.lgr.Warn(
+			"HTTP server did not shut down cleanly.",
+			"err", serr.Error(),
+		)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *Server) serve(listener net.Listener) error {
+	if s.cnf.UseTLS() {
+		return s.srv.ServeTLS(listener, "", "")
+	}
+
+	return s.srv.Serve(listener)
+}
+
+/* server.go ends here. */